@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mtratsiuk/b3/pkg/app"
 )
@@ -16,6 +19,9 @@ var rootPath string
 var prod bool
 var dry bool
 var mode string
+var ref string
+var force bool
+var format string
 
 func init() {
 	wd, err := os.Getwd()
@@ -25,11 +31,14 @@ func init() {
 	}
 
 	flag.StringVar(&rootPath, "root", wd, "path to the blog's root directory (folder containing 'b3.json')")
-	flag.StringVar(&mode, "mode", "build", "'build' - build html files from markdown posts\n'cdn' - upload assets to cdn and replace urls in markdown files")
+	flag.StringVar(&mode, "mode", "build", "'build' - build html files from markdown posts\n'cdn' - upload assets to cdn and replace urls in markdown files\n'cdn-rollback' - restore markdown files rewritten by the last 'cdn' run\n'cdn-gc' - delete cdn objects not referenced by posts, listed by a preceding '-dry' run")
 	flag.BoolVar(&verbose, "v", false, "verbose logging (debug)")
 	flag.BoolVar(&help, "h", false, "print help (usage)")
 	flag.BoolVar(&prod, "prod", false, "enable production build")
-	flag.BoolVar(&dry, "dry", false, "execute in dry-run mode (preview affected assets before making actual CDN uploads)")
+	flag.BoolVar(&dry, "dry", false, "execute in dry-run mode (preview affected assets before making actual CDN uploads or deletions)")
+	flag.StringVar(&ref, "ref", "", "build from the tree of git commit, tag or branch instead of the working tree")
+	flag.StringVar(&format, "format", "text", "format of dry-run report in 'cdn' and 'cdn-gc' modes: 'text' or 'json'")
+	flag.BoolVar(&force, "force", false, "rewrite markdown files with uncommitted changes in 'cdn' mode")
 }
 
 func main() {
@@ -37,11 +46,22 @@ func main() {
 
 	logLevel := slog.LevelWarn
 
+	// Report progress of uploads
+	if mode == "cdn" || mode == "cdn-rollback" || mode == "cdn-gc" {
+		logLevel = slog.LevelInfo
+	}
+
 	if verbose {
 		logLevel = slog.LevelDebug
 	}
 
-	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+	// Keep stdout parseable
+	logOut := os.Stdout
+	if format == "json" {
+		logOut = os.Stderr
+	}
+
+	log := slog.New(slog.NewTextHandler(logOut, &slog.HandlerOptions{Level: logLevel}))
 
 	log.Debug(
 		fmt.Sprintf(`got args:
@@ -51,6 +71,9 @@ rootPath=%v,
 prod=%v,
 dry=%v,
 mode=%v,
+ref=%v,
+force=%v,
+format=%v,
 `,
 			verbose,
 			help,
@@ -58,6 +81,9 @@ mode=%v,
 			prod,
 			dry,
 			mode,
+			ref,
+			force,
+			format,
 		),
 	)
 
@@ -72,6 +98,9 @@ mode=%v,
 		RootPath: rootPath,
 		Prod:     prod,
 		DryRun:   dry,
+		Ref:      ref,
+		Force:    force,
+		Format:   format,
 	})
 
 	if err != nil {
@@ -79,10 +108,22 @@ mode=%v,
 		os.Exit(1)
 	}
 
+	// Cancel in-flight uploads on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	var cmd func() error
 
 	if mode == "cdn" {
-		cmd = b3app.Cdn
+		cmd = func() error {
+			return b3app.Cdn(ctx)
+		}
+	} else if mode == "cdn-gc" {
+		cmd = func() error {
+			return b3app.CdnGc(ctx)
+		}
+	} else if mode == "cdn-rollback" {
+		cmd = b3app.CdnRollback
 	} else if mode == "build" {
 		cmd = func() error {
 			_, err := b3app.Build()
@@ -96,5 +137,6 @@ mode=%v,
 
 	if err := cmd(); err != nil {
 		log.Error(fmt.Sprintf("main: failed to run b3: %v", err))
+		os.Exit(1)
 	}
 }
@@ -2,9 +2,15 @@ package app
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	neturl "net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -14,6 +20,10 @@ import (
 
 	"github.com/mtratsiuk/b3/pkg/cdn"
 	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/feed"
+	"github.com/mtratsiuk/b3/pkg/git"
+	"github.com/mtratsiuk/b3/pkg/markdown"
+	"github.com/mtratsiuk/b3/pkg/related"
 	"github.com/mtratsiuk/b3/pkg/templates"
 	"github.com/mtratsiuk/b3/pkg/timestamper"
 	"github.com/mtratsiuk/b3/pkg/utils"
@@ -27,41 +37,104 @@ type Params struct {
 	RootPath string
 	Prod     bool
 	DryRun   bool
+	Ref      string    // build from the tree of the git commit instead of the working tree
+	Force    bool      // rewrite posts with uncommitted changes in cdn mode
+	Out      io.Writer // output of dry-run reports, defaults to stdout
+	Format   string    // format of dry-run reports: `text` (default) or `json`
 }
 
 type App struct {
 	log         *slog.Logger
 	params      Params
 	config      config.Config
+	src         utils.Fs
 	outDirPath  string
 	timestamper timestamper.Timestamper
 	templates   templates.Templates
 	cdn         cdn.Cdn
+	manifest    *cdn.Manifest // set if cdn urls are substituted while building, or images have variants
 }
 
 type Post struct {
-	Id           PostId
-	FilePath     string
-	HtmlFilePath string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	Title        template.HTML
-	Description  template.HTML
+	Id              PostId
+	Collection      string
+	FilePath        string
+	BundleDirPath   string
+	HtmlFilePath    string
+	HistoryFilePath string // empty if `post_history` is disabled
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Unpublished     bool // has uncommitted changes, only tracked in dev builds
+	Title           template.HTML
+	Description     template.HTML
+	Html            template.HTML
+	Text            string
+	Tags            []string
+	FrontMatter     utils.FrontMatter
+	Author          config.ConfigAuthor // has empty id for authors not listed in config
 }
 
 type PostId string
 
+const BUNDLE_INDEX_FILE_NAME = "index.md"
+const BUNDLE_INDEX_HTML_FILE_NAME = "index.html"
+
+// PostSource is a markdown file matched by posts glob. Posts can either be
+// a single markdown file, or a directory (bundle) with `index.md` file and
+// co-located assets
+type PostSource struct {
+	Id            PostId
+	FilePath      string
+	BundleDirPath string
+}
+
 type Posts = map[PostId]*Post
 
 func New(params Params) (App, error) {
 	app := App{}
 
-	cfg, err := config.New(params.RootPath)
+	var src utils.Fs = utils.OsFs{}
+	timestampers := []string{}
+
+	if params.Ref != "" {
+		refSrc, rootPath, err := openRef(params.RootPath, params.Ref)
+		if err != nil {
+			return App{}, fmt.Errorf("app.New: failed to read git ref %v: %v", params.Ref, err)
+		}
+		src = refSrc
+		params.RootPath = rootPath
+		params.Log.Debug(fmt.Sprintf("app.New: reading sources from git ref: %v", params.Ref))
+	}
+
+	cfg, err := config.New(src, params.RootPath)
 	if err != nil {
 		return App{}, fmt.Errorf("app.New: failed to create config: %v", err)
 	}
 	params.Log.Debug(fmt.Sprintf("app.New: created config: %v", cfg))
 
+	for _, t := range cfg.Timestamper {
+		// Working tree modification times are unrelated to the ref's files
+		if params.Ref != "" && t == timestamper.FS {
+			continue
+		}
+		timestampers = append(timestampers, t)
+	}
+
+	ts, err := timestamper.New(timestampers, timestamper.Options{
+		Git: timestamper.GitOptions{
+			UncommittedTimestamp: cfg.Git.UncommittedTimestamp,
+			ShallowClone:         cfg.Git.ShallowClone,
+			Ref:                  params.Ref,
+			IgnoreMessages:       cfg.Git.IgnoreCommits.Messages,
+			IgnoreAuthors:        cfg.Git.IgnoreCommits.Authors,
+			MinChangedLines:      cfg.Git.IgnoreCommits.MinChangedLines,
+		},
+		ReadFile: src.ReadFile,
+	})
+	if err != nil {
+		return App{}, fmt.Errorf("app.New: failed to create timestamper: %v", err)
+	}
+
 	tmplts, err := templates.New(cfg)
 	if err != nil {
 		return App{}, fmt.Errorf("app.New: failed to load templates: %v", err)
@@ -74,15 +147,40 @@ func New(params Params) (App, error) {
 		params.Log.Debug("app.New: loaded dotenv file")
 	}
 
+	if params.Out == nil {
+		params.Out = os.Stdout
+	}
+
 	app.log = params.Log
 	app.params = params
 	app.config = cfg
+	app.src = src
 	app.outDirPath = filepath.Join(params.RootPath, cfg.OutDirPath)
-	app.timestamper = timestamper.NewGit()
+	app.timestamper = ts
 	app.templates = tmplts
 
+	if cfg.AssetsToUploadRegexp != "" && (cfg.Cdn.UrlSubstitution == config.CDN_URLS_BUILD || len(cfg.Images.Widths) > 0) {
+		manifestPath := app.ResolveRelativePath(cfg.Cdn.ManifestPath)
+
+		data, err := src.ReadFile(manifestPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return App{}, fmt.Errorf("app.New: failed to read cdn manifest: %v", err)
+		}
+
+		app.manifest, err = cdn.ParseManifest(manifestPath, data)
+		if err != nil {
+			return App{}, fmt.Errorf("app.New: failed to parse cdn manifest: %v", err)
+		}
+	}
+
 	if cfg.AssetsToUploadRegexp != "" {
-		cdn, err := cdn.New()
+		cdnCfg := cfg.Cdn
+		if cdnCfg.Local.DirPath != "" && !filepath.IsAbs(cdnCfg.Local.DirPath) {
+			cdnCfg.Local.DirPath = filepath.Join(params.RootPath, cdnCfg.Local.DirPath)
+		}
+		cdnCfg.ManifestPath = app.ResolveRelativePath(cdnCfg.ManifestPath)
+
+		cdn, err := cdn.New(cdnCfg, params.RootPath, cfg.Images.Widths)
 		if err != nil {
 			return App{}, fmt.Errorf("app.New: failed to create cdn: %v", err)
 		}
@@ -92,6 +190,52 @@ func New(params Params) (App, error) {
 	return app, nil
 }
 
+// openRef returns sources of the git commit `ref` from the repository containing `rootPath`,
+// and `rootPath` with symlinks resolved the same way as the repository's root
+func openRef(rootPath string, ref string) (utils.Fs, string, error) {
+	repo, err := git.Open(rootPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Otherwise repository is read by the returned sources until b3 exits
+	defer func() {
+		if err != nil {
+			repo.Close()
+		}
+	}()
+
+	tree, err := git.NewTreeFs(repo, ref)
+	if err != nil {
+		return nil, "", err
+	}
+
+	toplevel, err := repo.Toplevel()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(toplevel); err == nil {
+		toplevel = resolved
+	}
+
+	rootPath, err = filepath.Abs(rootPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(rootPath); err == nil {
+		rootPath = resolved
+	}
+
+	src, err := utils.NewMountedFs(toplevel, tree)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return src, rootPath, nil
+}
+
 func (app *App) ResolveRelativePath(path string) string {
 	return filepath.Join(app.params.RootPath, path)
 }
@@ -105,20 +249,53 @@ func (app *App) Build() (Posts, error) {
 		return nil, fmt.Errorf("app.Build: failed to copy assets to out directory: %v", err)
 	}
 
+	pages, err := app.loadPages()
+	if err != nil {
+		return nil, fmt.Errorf("app.Build: failed to load pages: %v", err)
+	}
+
+	if err := app.resolveHeaderLinks(pages); err != nil {
+		return nil, fmt.Errorf("app.Build: failed to resolve header links: %v", err)
+	}
+
 	posts, err := app.renderPosts()
 	if err != nil {
 		return nil, fmt.Errorf("app.Build: failed to render posts: %v", err)
 	}
 
+	if err := app.checkPagePaths(pages, posts); err != nil {
+		return nil, fmt.Errorf("app.Build: %v", err)
+	}
+
+	if err := app.renderPages(pages); err != nil {
+		return nil, fmt.Errorf("app.Build: failed to render pages: %v", err)
+	}
+
 	if err := app.renderHome(posts); err != nil {
 		return nil, fmt.Errorf("app.Build: failed to render home page: %v", err)
 	}
 
+	if err := app.renderListings(posts); err != nil {
+		return nil, fmt.Errorf("app.Build: failed to render collection listing pages: %v", err)
+	}
+
+	if err := app.renderFeed(posts); err != nil {
+		return nil, fmt.Errorf("app.Build: failed to render feed: %v", err)
+	}
+
+	if err := app.renderAuthors(posts); err != nil {
+		return nil, fmt.Errorf("app.Build: failed to render author pages: %v", err)
+	}
+
 	return posts, nil
 }
 
-func (app *App) Cdn() error {
-	if err := app.uploadAssets(); err != nil {
+func (app *App) Cdn(ctx context.Context) error {
+	if app.params.Ref != "" {
+		return fmt.Errorf("app.Cdn: posts can't be updated when reading sources from git ref")
+	}
+
+	if err := app.uploadAssets(ctx); err != nil {
 		return fmt.Errorf("app.Cdn: failed to upload assets to cdn: %v", err)
 	}
 
@@ -126,44 +303,95 @@ func (app *App) Cdn() error {
 }
 
 func (app *App) renderPosts() (Posts, error) {
-	posts := make(Posts, 0)
+	posts, err := app.loadPosts()
+	if err != nil {
+		return posts, err
+	}
 
-	for _, pg := range app.config.PostsGlob {
-		glob := app.ResolveRelativePath(pg)
+	// Posts link to their history pages, so posts without history are known before rendering
+	if app.config.PostHistory {
+		if err := app.renderHistories(posts); err != nil {
+			return posts, err
+		}
+	}
+
+	related := app.findRelatedPosts(posts)
+
+	for _, post := range posts {
+		relatedPosts := make([]*Post, 0, len(related[post.Id]))
+		for _, id := range related[post.Id] {
+			relatedPosts = append(relatedPosts, posts[id])
+		}
+
+		if err := app.renderPost(post, relatedPosts); err != nil {
+			return posts, fmt.Errorf("renderPosts: failed to render post %v: %v", post.Id, err)
+		}
+		app.log.Debug(fmt.Sprintf("renderPosts: rendered post: %v", post.HtmlFilePath))
+	}
+
+	return posts, nil
+}
 
-		matches, err := filepath.Glob(glob)
+func (app *App) loadPosts() (Posts, error) {
+	posts := make(Posts, 0)
 
+	for _, coll := range app.config.Collections {
+		sources, err := app.matchPostSources(coll.Glob)
 		if err != nil {
-			return posts, fmt.Errorf("renderPosts: failed to match glob pattern '%v': %v", glob, err)
+			return posts, fmt.Errorf("loadPosts: %v", err)
 		}
 
-		for _, p := range matches {
-			app.log.Debug(fmt.Sprintf("renderPosts: processing post match: %v", p))
+		for _, src := range sources {
+			app.log.Debug(fmt.Sprintf("loadPosts: processing post match: %v", src.FilePath))
 
-			filename := filepath.Base(p)
-			title, _ := strings.CutSuffix(filename, filepath.Ext(filename))
+			if dup, ok := posts[src.Id]; ok {
+				return posts, fmt.Errorf("loadPosts: duplicate post id '%v' for %v and %v", src.Id, dup.FilePath, src.FilePath)
+			}
 
 			post := Post{}
-			post.Id = PostId(title)
-			post.FilePath = p
-
-			createdAt, err := app.timestamper.CreatedAt(p)
+			post.Id = src.Id
+			post.Collection = coll.Name
+			post.FilePath = src.FilePath
+			post.BundleDirPath = src.BundleDirPath
+
+			createdAt, err := app.timestamper.CreatedAt(post.FilePath)
+			if errors.Is(err, timestamper.ErrShallowClone) {
+				return posts, fmt.Errorf("loadPosts: failed to read CreatedAt time of %v: %v", post.FilePath, err)
+			}
 			if err != nil {
-				app.log.Warn(fmt.Sprintf("renderPosts: failed to read CreatedAt time: %v", err))
+				app.log.Warn(fmt.Sprintf("loadPosts: failed to read CreatedAt time: %v", err))
 			}
 			post.CreatedAt = createdAt
 
-			updatedAt, err := app.timestamper.UpdatedAt(p)
+			updatedAt, err := app.timestamper.UpdatedAt(post.FilePath)
+			if errors.Is(err, timestamper.ErrShallowClone) {
+				return posts, fmt.Errorf("loadPosts: failed to read UpdatedAt time of %v: %v", post.FilePath, err)
+			}
 			if err != nil {
-				app.log.Warn(fmt.Sprintf("renderPosts: failed to read UpdatedAt time: %v", err))
+				app.log.Warn(fmt.Sprintf("loadPosts: failed to read UpdatedAt time: %v", err))
 			}
 			post.UpdatedAt = updatedAt
 
-			err = app.renderPost(&post)
+			if tracker, ok := app.timestamper.(timestamper.Tracker); ok && !app.params.Prod {
+				uncommitted, err := tracker.Uncommitted(post.FilePath)
+				if err != nil {
+					app.log.Warn(fmt.Sprintf("loadPosts: failed to check uncommitted changes: %v", err))
+				}
+				post.Unpublished = uncommitted
+			}
+
+			err = app.loadPost(&post, coll.UrlPrefix)
 			if err != nil {
-				return posts, fmt.Errorf("renderPosts: failed to render post %v: %v", post, err)
+				return posts, fmt.Errorf("loadPosts: failed to load post %v: %v", post.FilePath, err)
+			}
+			if app.config.PostHistory {
+				post.HistoryFilePath = historyFilePath(&post)
 			}
-			app.log.Debug(fmt.Sprintf("renderPosts: rendered post: %v", post))
+
+			if err := app.loadAuthor(&post); err != nil {
+				app.log.Warn(fmt.Sprintf("loadPosts: failed to read post author: %v", err))
+			}
+			app.log.Debug(fmt.Sprintf("loadPosts: loaded post: %v", post.Id))
 
 			posts[post.Id] = &post
 		}
@@ -172,23 +400,73 @@ func (app *App) renderPosts() (Posts, error) {
 	return posts, nil
 }
 
-func (app *App) renderPost(post *Post) error {
-	in, err := os.ReadFile(post.FilePath)
-	if err != nil {
-		return err
+// renderMarkdown renders markdown file located in `srcDirPath` to html file located in `htmlDirPath`.
+// `bundleDirPath` is set if the file is a bundle's index, which assets are copied next to the html file
+func (app *App) renderMarkdown(in []byte, srcDirPath string, htmlDirPath string, bundleDirPath string) (string, error) {
+	relocation := app.newRelocation(srcDirPath, htmlDirPath, bundleDirPath)
+	in = relocation.rewrite(in)
+
+	if urls := app.newCdnUrls(srcDirPath, htmlDirPath); urls != nil {
+		rewritten, err := urls.rewrite(in)
+		if err != nil {
+			return "", err
+		}
+		in = rewritten
+	}
+
+	options := []goldmark.Option{goldmark.WithParserOptions(parser.WithAutoHeadingID())}
+	if len(app.config.Images.Widths) > 0 {
+		options = append(options, markdown.WithImageVariants(app.imageVariants(relocation), app.config.Images.Sizes))
 	}
 
-	md := goldmark.New(
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-	)
+	md := goldmark.New(options...)
 
 	var buf bytes.Buffer
 	if err := md.Convert(in, &buf); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// loadPost reads and parses post's markdown file. Post's html file is placed
+// to `<out_dir_path>/<urlPrefix>` directory, or to the same directory
+// relative to the out directory as the post's source if `urlPrefix` is empty
+func (app *App) loadPost(post *Post, urlPrefix string) error {
+	in, err := app.src.ReadFile(post.FilePath)
+	if err != nil {
+		return err
+	}
+
+	frontMatter, in, err := utils.ParseFrontMatter(in)
+	if err != nil {
+		return err
+	}
+	post.FrontMatter = frontMatter
+	post.Tags = frontMatter.List("tags")
+
+	postOutDirPath := filepath.Join(app.outDirPath, urlPrefix)
+	if urlPrefix == "" {
+		postOutDirPath = filepath.Join(app.outDirPath, app.relativeToRoot(filepath.Dir(post.FilePath)))
+	}
+
+	if post.BundleDirPath != "" {
+		if urlPrefix == "" {
+			postOutDirPath = filepath.Join(app.outDirPath, app.relativeToRoot(post.BundleDirPath))
+		} else {
+			postOutDirPath = filepath.Join(postOutDirPath, string(post.Id))
+		}
+		post.HtmlFilePath = filepath.Join(postOutDirPath, BUNDLE_INDEX_HTML_FILE_NAME)
+	} else {
+		post.HtmlFilePath = filepath.Join(postOutDirPath, string(post.Id)+".html")
+	}
+
+	html, err := app.renderMarkdown(in, filepath.Dir(post.FilePath), postOutDirPath, post.BundleDirPath)
+	if err != nil {
 		return err
 	}
-	html := buf.String()
+	post.Html = template.HTML(html)
+	post.Text = utils.StripHtml(html)
 
 	title, err := getPostTitleHtml(html)
 	if err != nil {
@@ -202,19 +480,42 @@ func (app *App) renderPost(post *Post) error {
 	}
 	post.Description = template.HTML(description)
 
+	return nil
+}
+
+func (app *App) renderPost(post *Post, related []*Post) error {
 	data := templates.PostData{
-		Title:       title,
-		Description: utils.TrimText(utils.StripHtml(description), app.config.TrimPostOgDescriptionsAt),
+		Title:       string(post.Title),
+		Description: utils.TrimText(utils.StripHtml(string(post.Description)), app.config.TrimPostOgDescriptionsAt),
 		CreatedAt:   post.CreatedAt,
 		UpdatedAt:   post.UpdatedAt,
-		PostHtml:    template.HTML(html),
+		Unpublished: post.Unpublished,
+		HistoryUrl:  app.historyUrl(post, filepath.Dir(post.HtmlFilePath)),
+		Author:      app.authorData(post.Author, filepath.Dir(post.HtmlFilePath)),
+		PostHtml:    post.Html,
+		Related:     make([]templates.RelatedPostData, 0, len(related)),
+	}
+
+	postOutDirPath := filepath.Dir(post.HtmlFilePath)
+
+	for _, rp := range related {
+		data.Related = append(data.Related, templates.RelatedPostData{
+			Id:        string(rp.Id),
+			Url:       app.postUrl(rp, postOutDirPath),
+			Title:     rp.Title,
+			CreatedAt: rp.CreatedAt,
+		})
 	}
 
-	postOutDirPath := filepath.Join(app.outDirPath, strings.TrimPrefix(filepath.Dir(post.FilePath), filepath.Clean(app.params.RootPath)))
 	if err := os.MkdirAll(postOutDirPath, os.ModePerm); err != nil {
 		return err
 	}
-	post.HtmlFilePath = filepath.Join(postOutDirPath, string(post.Id)+".html")
+
+	if post.BundleDirPath != "" {
+		if err := app.copyBundleAssets(post.BundleDirPath, postOutDirPath); err != nil {
+			return fmt.Errorf("failed to copy bundle assets: %v", err)
+		}
+	}
 
 	out, err := os.Create(post.HtmlFilePath)
 	if err != nil {
@@ -225,38 +526,134 @@ func (app *App) renderPost(post *Post) error {
 	return app.templates.RenderPost(out, data)
 }
 
-func (app *App) renderHome(posts map[PostId]*Post) error {
+func (app *App) findRelatedPosts(posts Posts) map[PostId][]PostId {
+	docs := make([]related.Document, 0, len(posts))
+
+	for _, p := range posts {
+		docs = append(docs, related.Document{
+			Id:   string(p.Id),
+			Tags: p.Tags,
+			Text: p.Text,
+		})
+	}
+
+	found := related.Find(docs, related.Params{
+		Count:         app.config.RelatedPosts.Count,
+		TagsWeight:    app.config.RelatedPosts.TagsWeight,
+		ContentWeight: app.config.RelatedPosts.ContentWeight,
+		MinScore:      app.config.RelatedPosts.MinScore,
+	})
+
+	result := make(map[PostId][]PostId, len(found))
+	for id, ids := range found {
+		for _, rid := range ids {
+			result[PostId(id)] = append(result[PostId(id)], PostId(rid))
+		}
+	}
+
+	app.log.Debug(fmt.Sprintf("findRelatedPosts: %v", result))
+
+	return result
+}
+
+// postUrl returns url of the post's html page relative to the `fromDirPath` directory
+func (app *App) postUrl(post *Post, fromDirPath string) string {
+	return app.relativeUrl(post.HtmlFilePath, fromDirPath)
+}
+
+// relativeUrl returns url of the html file from out directory relative to the `fromDirPath` directory
+func (app *App) relativeUrl(htmlFilePath string, fromDirPath string) string {
+	url, err := filepath.Rel(fromDirPath, htmlFilePath)
+	if err != nil {
+		url = filepath.Join(".", strings.TrimPrefix(htmlFilePath, filepath.Clean(app.outDirPath)))
+	}
+
+	return app.stripHtmlExt(filepath.ToSlash(url))
+}
+
+// absoluteUrl returns public url of the file from out directory based on `home_link`,
+// or url relative to the site's root if `home_link` is not defined
+func (app *App) absoluteUrl(filePath string) string {
+	rel := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(filePath, filepath.Clean(app.outDirPath))), "/")
+
+	if app.config.HomeLink == "" {
+		return "/" + app.stripHtmlExt(rel)
+	}
+
+	url, err := neturl.JoinPath(app.config.HomeLink, app.stripHtmlExt(rel))
+	if err != nil {
+		return app.config.HomeLink + app.stripHtmlExt(rel)
+	}
+
+	return url
+}
+
+func (app *App) stripHtmlExt(url string) string {
+	if app.params.Prod && app.config.StripHtmlExtInProdLinks {
+		if dir, isBundle := strings.CutSuffix(url, BUNDLE_INDEX_HTML_FILE_NAME); isBundle {
+			return dir
+		}
+
+		url, _ = strings.CutSuffix(url, ".html")
+	}
+
+	return url
+}
+
+func (app *App) renderHome(posts Posts) error {
 	data := templates.HomeData{}
 	data.Title = app.config.DocTitle
 	data.Description = app.config.DocDescription
-	data.Posts = make([]templates.HomePostData, 0)
+	data.Sections = make([]templates.HomeSectionData, 0)
 
-	for _, p := range posts {
-		url := filepath.Join(".", strings.TrimPrefix(p.HtmlFilePath, filepath.Clean(app.outDirPath)))
+	intro, err := app.loadHomeIntro(posts)
+	if err != nil {
+		return err
+	}
+	data.IntroHtml = intro.Html
 
-		if app.params.Prod && app.config.StripHtmlExtInProdLinks {
-			url, _ = strings.CutSuffix(url, ".html")
+	excluded := make(map[PostId]bool)
+	if intro.PostId != "" {
+		excluded[intro.PostId] = true
+	}
+
+	featured := make([]*Post, 0, len(intro.Featured))
+	for _, id := range intro.Featured {
+		p, ok := posts[id]
+		if !ok {
+			return fmt.Errorf("renderHome: featured post '%v' doesn't exist", id)
 		}
+		featured = append(featured, p)
+		excluded[id] = true
+	}
 
-		data.Posts = append(data.Posts, templates.HomePostData{
-			Id:          string(p.Id),
-			Title:       p.Title,
-			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
-			UpdatedAt:   p.UpdatedAt,
-			Url:         url,
-		})
+	data.Featured = app.postsData(featured, app.outDirPath)
+	for idx := range data.Featured {
+		data.Featured[idx].Featured = true
 	}
 
-	slices.SortFunc(data.Posts, func(a, b templates.HomePostData) int {
-		createdAtCmp := b.CreatedAt.Compare(a.CreatedAt)
+	onHome := make([]config.ConfigCollection, 0)
+
+	for _, coll := range app.config.Collections {
+		if coll.ExcludeFromHome {
+			continue
+		}
+		onHome = append(onHome, coll)
 
-		if createdAtCmp == 0 {
-			return strings.Compare(b.Id, a.Id)
+		section := templates.HomeSectionData{
+			Name:  coll.Name,
+			Title: coll.Title,
+			Posts: app.postsData(sortPosts(withoutPosts(collectionPosts(posts, coll), excluded), coll.Sort), app.outDirPath),
 		}
 
-		return createdAtCmp
-	})
+		if coll.Listing {
+			section.Url = app.relativeUrl(app.collectionListingFilePath(coll), app.outDirPath)
+		}
+
+		data.Sections = append(data.Sections, section)
+	}
+
+	data.Posts = app.postsData(sortPosts(withoutPosts(collectionPosts(posts, onHome...), excluded), config.SORT_CREATED_DESC), app.outDirPath)
 
 	app.log.Debug(fmt.Sprintf("renderHome: data: %v", data))
 
@@ -269,82 +666,318 @@ func (app *App) renderHome(posts map[PostId]*Post) error {
 	return app.templates.RenderHome(out, data)
 }
 
-func (app *App) uploadAssets() error {
-	if app.config.AssetsToUploadRegexp == "" {
-		app.log.Debug("uploadAssets: nothing to do, `assets_to_upload_regexp` is not defined")
-		return nil
-	}
+type HomeIntro struct {
+	Html     template.HTML
+	Featured []PostId
+	PostId   PostId // set if intro is defined by a post with `home_intro: true` front matter
+}
 
-	for _, pg := range app.config.PostsGlob {
-		glob := app.ResolveRelativePath(pg)
+// loadHomeIntro reads home page intro either from `home_intro_path` markdown file,
+// or from a post having `home_intro: true` in its front matter. Intro's front matter
+// can list `featured` post ids to be rendered first on the home page
+func (app *App) loadHomeIntro(posts Posts) (HomeIntro, error) {
+	intro := HomeIntro{Featured: make([]PostId, 0)}
 
-		matches, err := filepath.Glob(glob)
+	var frontMatter utils.FrontMatter
 
+	if app.config.HomeIntroPath != "" {
+		in, err := app.src.ReadFile(app.ResolveRelativePath(app.config.HomeIntroPath))
 		if err != nil {
-			return fmt.Errorf("uploadAssets: failed to match glob pattern '%v': %v", glob, err)
+			return intro, fmt.Errorf("loadHomeIntro: failed to read home intro file: %v", err)
 		}
 
-		for _, m := range matches {
-			app.log.Debug(fmt.Sprintf("uploadAssets: processing file %v", m))
+		frontMatter, in, err = utils.ParseFrontMatter(in)
+		if err != nil {
+			return intro, fmt.Errorf("loadHomeIntro: failed to parse home intro front matter: %v", err)
+		}
 
-			post, err := os.ReadFile(m)
-			if err != nil {
-				return fmt.Errorf("uploadAssets: failed read post file: %v", err)
+		html, err := app.renderMarkdown(in, filepath.Dir(app.ResolveRelativePath(app.config.HomeIntroPath)), app.outDirPath, "")
+		if err != nil {
+			return intro, fmt.Errorf("loadHomeIntro: failed to render home intro: %v", err)
+		}
+		intro.Html = template.HTML(html)
+	} else {
+		for _, p := range sortPosts(slices.Collect(maps.Values(posts)), config.SORT_ID_ASC) {
+			if !p.FrontMatter.Bool("home_intro") {
+				continue
 			}
 
-			updatedPost, err := app.uploadAssetsForPost(string(post), filepath.Dir(m))
-			if err != nil {
-				return fmt.Errorf("uploadAssets: failed process post %v: %v", m, err)
+			if intro.PostId != "" {
+				return intro, fmt.Errorf("loadHomeIntro: expected single post with `home_intro: true`, got %v and %v", intro.PostId, p.Id)
 			}
 
-			if err := os.WriteFile(m, []byte(updatedPost), 0644); err != nil {
-				return fmt.Errorf("uploadAssets: failed to write updated post %v: %v", m, err)
-			}
+			frontMatter = p.FrontMatter
+			intro.Html = p.Html
+			intro.PostId = p.Id
+		}
+	}
+
+	for _, id := range frontMatter.List("featured") {
+		intro.Featured = append(intro.Featured, PostId(id))
+	}
+
+	return intro, nil
+}
+
+func (app *App) renderListings(posts Posts) error {
+	for _, coll := range app.config.Collections {
+		if !coll.Listing {
+			continue
+		}
+
+		if err := app.renderListing(posts, coll); err != nil {
+			return fmt.Errorf("renderListings: failed to render listing of %v: %v", coll.Name, err)
 		}
 	}
 
 	return nil
 }
 
-var imageRe = regexp.MustCompile(`!\[.*\]\((.*)\)`)
+func (app *App) renderListing(posts Posts, coll config.ConfigCollection) error {
+	listingFilePath := app.collectionListingFilePath(coll)
 
-func (app *App) uploadAssetsForPost(content, postDirPath string) (string, error) {
-	uploadRe := regexp.MustCompile(app.config.AssetsToUploadRegexp)
-	updatedContent := content
+	data := templates.ListData{
+		Title:       coll.Title,
+		Description: app.config.DocDescription,
+		Posts:       app.postsData(sortPosts(collectionPosts(posts, coll), coll.Sort), filepath.Dir(listingFilePath)),
+	}
 
-	for _, match := range imageRe.FindAllStringSubmatch(content, -1) {
-		imageMd := match[0]
-		imagePath := match[1]
-		upload := uploadRe.MatchString(imagePath)
+	if err := os.MkdirAll(filepath.Dir(listingFilePath), os.ModePerm); err != nil {
+		return err
+	}
 
-		if !upload {
-			app.log.Debug(fmt.Sprintf("uploadAssetsForPost: skipping asset: %v", imageMd))
-			continue
+	out, err := os.Create(listingFilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return app.templates.RenderList(out, data)
+}
+
+func (app *App) renderFeed(posts Posts) error {
+	if app.config.HomeLink == "" {
+		app.log.Debug("renderFeed: nothing to do, `home_link` is not defined")
+		return nil
+	}
+
+	inFeed := make([]config.ConfigCollection, 0)
+	for _, coll := range app.config.Collections {
+		if !coll.ExcludeFromFeed {
+			inFeed = append(inFeed, coll)
 		}
+	}
 
-		app.log.Debug(fmt.Sprintf("uploadAssetsForPost: processing asset: %v", imageMd))
+	f := feed.Feed{
+		Id:       app.config.HomeLink,
+		Title:    app.config.DocTitle,
+		Subtitle: app.config.DocDescription,
+		Authors:  []feed.Person{{Name: app.config.DocTitle}},
+	}
 
-		if app.params.DryRun {
-			continue
+	return app.writeFeed(filepath.Join(app.outDirPath, feed.FILE_NAME), f, collectionPosts(posts, inFeed...))
+}
+
+// writeFeed writes feed `f` with entries for `posts` to `filePath`
+func (app *App) writeFeed(filePath string, f feed.Feed, posts []*Post) error {
+	f.Links = []feed.Link{
+		{Href: app.absoluteUrl(filePath), Rel: "self", Type: "application/atom+xml"},
+		{Href: f.Id, Rel: "alternate", Type: "text/html"},
+	}
+	f.Entries = make([]feed.Entry, 0, len(posts))
+
+	for _, p := range sortPosts(posts, config.SORT_CREATED_DESC) {
+		url := app.absoluteUrl(p.HtmlFilePath)
+
+		entry := feed.Entry{
+			Id:        url,
+			Title:     utils.StripHtml(string(p.Title)),
+			Published: feed.FormatTime(p.CreatedAt),
+			Updated:   feed.FormatTime(p.UpdatedAt),
+			Links:     []feed.Link{{Href: url, Rel: "alternate", Type: "text/html"}},
+			Summary:   &feed.Text{Type: "html", Value: string(p.Description)},
+		}
+
+		if p.Author.Name != "" {
+			entry.Authors = []feed.Person{{Name: p.Author.Name, Uri: p.Author.Url}}
+		}
+
+		f.Entries = append(f.Entries, entry)
+	}
+
+	out, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return feed.Write(out, f)
+}
+
+func (app *App) postsData(posts []*Post, fromDirPath string) []templates.HomePostData {
+	data := make([]templates.HomePostData, 0, len(posts))
+
+	for _, p := range posts {
+		data = append(data, templates.HomePostData{
+			Id:          string(p.Id),
+			Collection:  p.Collection,
+			Title:       p.Title,
+			Description: p.Description,
+			CreatedAt:   p.CreatedAt,
+			UpdatedAt:   p.UpdatedAt,
+			Unpublished: p.Unpublished,
+			HistoryUrl:  app.historyUrl(p, fromDirPath),
+			Url:         app.postUrl(p, fromDirPath),
+		})
+	}
+
+	return data
+}
+
+func (app *App) collectionListingFilePath(coll config.ConfigCollection) string {
+	prefix := coll.UrlPrefix
+	if prefix == "" {
+		prefix = coll.Name
+	}
+
+	return filepath.Join(app.outDirPath, prefix, "index.html")
+}
+
+func collectionPosts(posts Posts, collections ...config.ConfigCollection) []*Post {
+	result := make([]*Post, 0)
+
+	for _, p := range posts {
+		for _, coll := range collections {
+			if p.Collection == coll.Name {
+				result = append(result, p)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+func withoutPosts(posts []*Post, excluded map[PostId]bool) []*Post {
+	return slices.DeleteFunc(posts, func(p *Post) bool {
+		return excluded[p.Id]
+	})
+}
+
+func sortPosts(posts []*Post, order string) []*Post {
+	slices.SortFunc(posts, func(a, b *Post) int {
+		idCmp := strings.Compare(string(b.Id), string(a.Id))
+
+		cmp := 0
+		switch order {
+		case config.SORT_CREATED_ASC:
+			cmp = a.CreatedAt.Compare(b.CreatedAt)
+			idCmp = -idCmp
+		case config.SORT_UPDATED_DESC:
+			cmp = b.UpdatedAt.Compare(a.UpdatedAt)
+		case config.SORT_ID_ASC:
+			idCmp = -idCmp
+		case config.SORT_ID_DESC:
+		default:
+			cmp = b.CreatedAt.Compare(a.CreatedAt)
+		}
+
+		if cmp == 0 {
+			return idCmp
 		}
 
-		publicUrl, err := app.cdn.UploadAsset(filepath.Join(postDirPath, imagePath))
+		return cmp
+	})
+
+	return posts
+}
+
+func (app *App) matchPostSources(globs []string) ([]PostSource, error) {
+	sources := make([]PostSource, 0)
+
+	for _, pg := range globs {
+		glob := app.ResolveRelativePath(pg)
+
+		matches, err := app.src.Glob(glob)
+
 		if err != nil {
-			return content, fmt.Errorf("uploadAssetsForPost: failed to upload asset: %v: %v", imageMd, err)
+			return sources, fmt.Errorf("failed to match glob pattern '%v': %v", glob, err)
+		}
+
+		for _, m := range matches {
+			stat, err := app.src.Stat(m)
+			if err != nil {
+				return sources, fmt.Errorf("failed to stat glob match '%v': %v", m, err)
+			}
+
+			if !stat.IsDir() && filepath.Ext(m) != ".md" {
+				app.log.Debug(fmt.Sprintf("matchPostSources: skipping non-markdown file: %v", m))
+				continue
+			}
+
+			if !stat.IsDir() {
+				filename := filepath.Base(m)
+				id, _ := strings.CutSuffix(filename, filepath.Ext(filename))
+				sources = append(sources, PostSource{Id: PostId(id), FilePath: m})
+				continue
+			}
+
+			indexPath := filepath.Join(m, BUNDLE_INDEX_FILE_NAME)
+			if _, err := app.src.Stat(indexPath); err != nil {
+				app.log.Debug(fmt.Sprintf("matchPostSources: skipping directory without %v: %v", BUNDLE_INDEX_FILE_NAME, m))
+				continue
+			}
+
+			sources = append(sources, PostSource{
+				Id:            PostId(filepath.Base(m)),
+				FilePath:      indexPath,
+				BundleDirPath: m,
+			})
 		}
+	}
+
+	return sources, nil
+}
 
-		app.log.Debug(fmt.Sprintf("uploadAssetsForPost: uploaded asset: %v to %v", imageMd, publicUrl))
+// copyBundleAssets copies everything except markdown files and assets
+// meant to be uploaded to CDN from bundle directory to the post's out directory
+func (app *App) copyBundleAssets(bundleDirPath, outDirPath string) error {
+	var uploadRe *regexp.Regexp
+	if app.config.AssetsToUploadRegexp != "" {
+		uploadRe = regexp.MustCompile(app.config.AssetsToUploadRegexp)
+	}
 
-		updatedMd := strings.ReplaceAll(imageMd, imagePath, publicUrl)
-		updatedContent = strings.ReplaceAll(updatedContent, imageMd, updatedMd)
+	bundleFs, err := app.src.Sub(bundleDirPath)
+	if err != nil {
+		return err
 	}
 
-	return updatedContent, nil
+	return utils.CopyFsFunc(bundleFs, outDirPath, func(path string, d fs.DirEntry) bool {
+		if d.IsDir() {
+			return false
+		}
+
+		if filepath.Ext(path) == ".md" {
+			return true
+		}
+
+		rel := filepath.ToSlash(path)
+		return uploadRe != nil && (uploadRe.MatchString(rel) || uploadRe.MatchString("./"+rel))
+	})
+}
+
+func (app *App) relativeToRoot(path string) string {
+	return strings.TrimPrefix(path, filepath.Clean(app.params.RootPath))
 }
 
 func (app *App) copyAssets() error {
 	for _, dir := range app.config.AssetsDirPath {
-		if err := utils.CopyDir(app.ResolveRelativePath(dir), filepath.Join(app.outDirPath, dir)); err != nil {
+		assetsFs, err := app.src.Sub(app.ResolveRelativePath(dir))
+		if err != nil {
+			return err
+		}
+
+		if err := utils.CopyFsFunc(assetsFs, filepath.Join(app.outDirPath, dir), nil); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/feed"
+	"github.com/mtratsiuk/b3/pkg/templates"
+	"github.com/mtratsiuk/b3/pkg/timestamper"
+)
+
+const AUTHORS_URL_PREFIX = "authors"
+
+// loadAuthor sets post's author from front matter `author`, or from the author of the
+// post's first commit. Authors listed in config are matched by id, email or name
+func (app *App) loadAuthor(post *Post) error {
+	name := post.FrontMatter.String("author")
+	email := ""
+
+	if attributor, ok := app.timestamper.(timestamper.Attributor); ok && name == "" {
+		author, err := attributor.Author(post.FilePath)
+		if err != nil && !errors.Is(err, timestamper.ErrNoTimestamp) {
+			return err
+		}
+		name, email = author.Name, author.Email
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	for _, a := range app.config.Authors {
+		if a.Id == name || a.Name == name || slices.ContainsFunc(a.Emails, func(e string) bool {
+			return strings.EqualFold(e, email) || strings.EqualFold(e, name)
+		}) {
+			post.Author = a
+			return nil
+		}
+	}
+
+	post.Author = config.ConfigAuthor{Name: name}
+
+	return nil
+}
+
+func (app *App) authorPageFilePath(author config.ConfigAuthor) string {
+	return filepath.Join(app.outDirPath, AUTHORS_URL_PREFIX, author.Id, "index.html")
+}
+
+// authorData returns author of the post, or nil if the post has no author
+func (app *App) authorData(author config.ConfigAuthor, fromDirPath string) *templates.AuthorData {
+	if author.Name == "" {
+		return nil
+	}
+
+	data := templates.AuthorData{
+		Id:     author.Id,
+		Name:   author.Name,
+		Avatar: author.Avatar,
+		Url:    author.Url,
+	}
+
+	if author.Id != "" {
+		data.PageUrl = app.relativeUrl(app.authorPageFilePath(author), fromDirPath)
+	}
+
+	return &data
+}
+
+func authorPosts(posts Posts, author config.ConfigAuthor) []*Post {
+	result := make([]*Post, 0)
+
+	for _, p := range posts {
+		if p.Author.Id == author.Id {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+// renderAuthors renders listing page and feed of each author listed in config
+func (app *App) renderAuthors(posts Posts) error {
+	for _, author := range app.config.Authors {
+		if err := app.renderAuthor(posts, author); err != nil {
+			return fmt.Errorf("renderAuthors: failed to render author %v: %v", author.Id, err)
+		}
+		app.log.Debug(fmt.Sprintf("renderAuthors: rendered author: %v", author.Id))
+	}
+
+	return nil
+}
+
+func (app *App) renderAuthor(posts Posts, author config.ConfigAuthor) error {
+	pageFilePath := app.authorPageFilePath(author)
+	pageDirPath := filepath.Dir(pageFilePath)
+	feedFilePath := filepath.Join(pageDirPath, feed.FILE_NAME)
+	authored := sortPosts(authorPosts(posts, author), config.SORT_CREATED_DESC)
+
+	data := templates.ListData{
+		Title:       author.Name,
+		Description: fmt.Sprintf("Posts by %v", author.Name),
+		Author:      app.authorData(author, pageDirPath),
+		Posts:       app.postsData(authored, pageDirPath),
+	}
+
+	if err := os.MkdirAll(pageDirPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	if app.config.HomeLink != "" {
+		data.FeedUrl = feed.FILE_NAME
+
+		f := feed.Feed{
+			Id:       app.absoluteUrl(pageFilePath),
+			Title:    fmt.Sprintf("%v - %v", app.config.DocTitle, author.Name),
+			Subtitle: data.Description,
+			Authors:  []feed.Person{{Name: author.Name, Uri: author.Url}},
+		}
+
+		if err := app.writeFeed(feedFilePath, f, authored); err != nil {
+			return fmt.Errorf("failed to write feed: %v", err)
+		}
+	}
+
+	out, err := os.Create(pageFilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return app.templates.RenderList(out, data)
+}
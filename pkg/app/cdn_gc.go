@@ -0,0 +1,318 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mtratsiuk/b3/pkg/git"
+	"github.com/mtratsiuk/b3/pkg/markdown"
+	"github.com/mtratsiuk/b3/pkg/utils"
+)
+
+// gcPlan lists unreferenced objects found by `-mode cdn-gc -dry`
+type gcPlan struct {
+	CreatedAt time.Time  `json:"created_at"`
+	Objects   []gcObject `json:"objects"`
+}
+
+type gcObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// CdnGc deletes objects under the key prefix which are not referenced by posts and pages.
+// Dry run writes the plan listing unreferenced objects, and only objects listed in the plan,
+// which are still unreferenced and older than the grace period, are deleted by the next run.
+// Plans older than the grace period are rejected
+func (app *App) CdnGc(ctx context.Context) error {
+	if app.params.Ref != "" {
+		return fmt.Errorf("app.CdnGc: objects can't be collected when reading sources from git ref")
+	}
+
+	if app.config.AssetsToUploadRegexp == "" {
+		return fmt.Errorf("app.CdnGc: nothing to do, `assets_to_upload_regexp` is not defined")
+	}
+
+	grace, err := time.ParseDuration(app.config.Cdn.Gc.GracePeriod)
+	if err != nil {
+		return fmt.Errorf("app.CdnGc: invalid grace period: %v", err)
+	}
+
+	planPath := app.ResolveRelativePath(app.config.Cdn.Gc.PlanPath)
+
+	if app.params.DryRun {
+		unreferenced, err := app.unreferencedObjects(ctx, grace)
+		if err != nil {
+			return fmt.Errorf("app.CdnGc: %v", err)
+		}
+
+		plan := gcPlan{CreatedAt: time.Now().UTC(), Objects: unreferenced}
+
+		if err := writeGcPlan(planPath, plan); err != nil {
+			return fmt.Errorf("app.CdnGc: %v", err)
+		}
+
+		return app.printGcPlan(plan, planPath)
+	}
+
+	plan, err := readGcPlan(planPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("app.CdnGc: plan %v doesn't exist, review objects to delete with `-mode cdn-gc -dry` first", planPath)
+	}
+	if err != nil {
+		return fmt.Errorf("app.CdnGc: %v", err)
+	}
+
+	// Objects uploaded after an old plan was made could be listed as out of grace period now
+	if age := time.Since(plan.CreatedAt); age > grace {
+		return fmt.Errorf(
+			"app.CdnGc: plan %v made at %v is older than grace period %v, review objects to delete with `-mode cdn-gc -dry` again",
+			planPath, plan.CreatedAt, grace,
+		)
+	}
+
+	unreferenced, err := app.unreferencedObjects(ctx, grace)
+	if err != nil {
+		return fmt.Errorf("app.CdnGc: %v", err)
+	}
+
+	keys := make(map[string]bool, len(unreferenced))
+	for _, obj := range unreferenced {
+		keys[obj.Key] = true
+	}
+
+	errs := make([]error, 0)
+	deleted := 0
+
+	for _, obj := range plan.Objects {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		// Objects could be referenced again after the plan was made
+		if !keys[obj.Key] {
+			app.log.Info(fmt.Sprintf("app.CdnGc: keeping %v, it's referenced or in grace period now", obj.Key))
+			continue
+		}
+
+		if err := app.cdn.Delete(ctx, obj.Key); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		deleted += 1
+		app.log.Info(fmt.Sprintf("app.CdnGc: deleted %v", obj.Key))
+	}
+
+	app.log.Info(fmt.Sprintf("app.CdnGc: deleted %v of %v planned objects", deleted, len(plan.Objects)))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("app.CdnGc: %v", errors.Join(errs...))
+	}
+
+	// Next run requires a new dry run
+	if err := os.Remove(planPath); err != nil {
+		return fmt.Errorf("app.CdnGc: failed to remove plan: %v", err)
+	}
+
+	return nil
+}
+
+// unreferencedObjects returns stored objects which are not referenced and older than the grace period
+func (app *App) unreferencedObjects(ctx context.Context, grace time.Duration) ([]gcObject, error) {
+	referenced, err := app.referencedKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := app.cdn.Objects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-grace)
+
+	unreferenced := make([]gcObject, 0)
+
+	for _, obj := range objects {
+		if referenced[strings.TrimPrefix(obj.Key, "/")] {
+			continue
+		}
+
+		if obj.LastModified.After(cutoff) {
+			app.log.Debug(fmt.Sprintf("unreferencedObjects: keeping %v uploaded at %v, it's in grace period", obj.Key, obj.LastModified))
+			continue
+		}
+
+		unreferenced = append(unreferenced, gcObject{obj.Key, obj.Size, obj.LastModified})
+	}
+
+	slices.SortFunc(unreferenced, func(a, b gcObject) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return unreferenced, nil
+}
+
+// referencedKeys returns keys of objects referenced by posts and pages, either by public urls
+// or by local paths of uploaded assets, and keys of their variants. Leading slashes of keys are trimmed
+func (app *App) referencedKeys() (map[string]bool, error) {
+	uploadRe := regexp.MustCompile(app.config.AssetsToUploadRegexp)
+	keys := make(map[string]bool)
+
+	// Variants of images are referenced together with the images
+	addKey := func(key string) {
+		keys[strings.TrimPrefix(key, "/")] = true
+		for _, v := range app.cdn.VariantKeys(key) {
+			keys[strings.TrimPrefix(v, "/")] = true
+		}
+	}
+
+	add := func(content []byte, dirPath string) {
+		if _, body, err := utils.ParseFrontMatter(content); err == nil {
+			content = body
+		}
+
+		for _, ref := range markdown.Refs(content) {
+			if key, ok := app.cdn.Key(ref.Dest); ok {
+				addKey(key)
+				continue
+			}
+
+			if dirPath == "" || !uploadRe.MatchString(ref.Dest) {
+				continue
+			}
+
+			plan, err := app.cdn.PlanAsset(filepath.Join(dirPath, filepath.FromSlash(ref.Dest)))
+			if err != nil {
+				app.log.Debug(fmt.Sprintf("referencedKeys: skipping %v: %v", ref.Dest, err))
+				continue
+			}
+
+			addKey(plan.Key)
+		}
+	}
+
+	sources, err := app.matchPostSources(append(app.config.PostsGlobs(), app.config.PagesGlob...))
+	if err != nil {
+		return nil, err
+	}
+
+	if app.config.HomeIntroPath != "" {
+		sources = append(sources, PostSource{FilePath: app.ResolveRelativePath(app.config.HomeIntroPath)})
+	}
+
+	for _, src := range sources {
+		content, err := os.ReadFile(src.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %v: %v", src.FilePath, err)
+		}
+
+		add(content, filepath.Dir(src.FilePath))
+	}
+
+	if !app.config.Cdn.Gc.AllRevisions {
+		return keys, nil
+	}
+
+	// Local paths in old revisions can't be resolved to the assets' content, only urls are collected
+	repo, err := git.Open(app.params.RootPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository: %v", err)
+	}
+	defer repo.Close()
+
+	history, err := git.LoadHistory(repo, "")
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]bool)
+	for _, c := range history.Commits {
+		for _, ch := range c.Changes {
+			if ch.Status != 'D' && filepath.Ext(ch.Path) == ".md" && !blobs[ch.NewBlob] {
+				blobs[ch.NewBlob] = true
+
+				content, err := repo.ReadBlob(ch.NewBlob)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %v at %v: %v", ch.Path, c.Hash, err)
+				}
+
+				add(content, "")
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+func (app *App) printGcPlan(plan gcPlan, planPath string) error {
+	if app.params.Format == FORMAT_JSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("printGcPlan: %v", err)
+		}
+
+		_, err = fmt.Fprintln(app.params.Out, string(data))
+		return err
+	}
+
+	w := tabwriter.NewWriter(app.params.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "KEY\tSIZE\tLAST MODIFIED")
+	size := 0
+	for _, obj := range plan.Objects {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", obj.Key, formatSize(int(obj.Size)), obj.LastModified.Format(time.DateTime))
+		size += int(obj.Size)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(
+		app.params.Out, "\n%v unreferenced objects (%v) are written to %v, run `-mode cdn-gc` without `-dry` to delete them\n",
+		len(plan.Objects), formatSize(size), planPath,
+	)
+
+	return nil
+}
+
+func readGcPlan(path string) (gcPlan, error) {
+	var plan gcPlan
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return plan, err
+	}
+
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return plan, fmt.Errorf("failed to parse plan %v: %v", path, err)
+	}
+
+	return plan, nil
+}
+
+func writeGcPlan(path string, plan gcPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write plan: %v", err)
+	}
+
+	return nil
+}
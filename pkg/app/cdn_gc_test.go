@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCdnGc(t *testing.T) {
+	tests := []struct {
+		name       string
+		referenced bool          // unreferenced object is referenced after the dry run
+		planAge    time.Duration // of the plan when objects are deleted
+		err        string
+		deleted    bool
+	}{
+		{"unreferenced object deleted", false, 0, "", true},
+		{"object referenced after dry run", true, 0, "", false},
+		{"plan older than grace period", false, 2 * time.Hour, "older than grace period", false},
+	}
+
+	// 112px wide image of the example blog
+	png, err := os.ReadFile(filepath.Join("..", "..", "example", "assets", "rock.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		app := newTestApp(t, `{
+			"posts_glob": ["./posts/*"],
+			"assets_to_upload_regexp": "^\\.\\./cdn/",
+			"images": {"widths": [10]},
+			"cdn": {
+				"backend": "local",
+				"key_prefix": "assets",
+				"local": {"dir_path": "./bucket", "public_url": "https://cdn.example.com"},
+				"gc": {"grace_period": "1h"}
+			}
+		}`)
+		dir := app.params.RootPath
+
+		writeTestFile(t, filepath.Join(dir, "cdn", "a.png"), string(png))
+		for _, name := range []string{"b", "c", "d"} {
+			writeTestFile(t, filepath.Join(dir, "cdn", name+".txt"), name)
+		}
+
+		uploads := make(map[string]string)
+		for _, name := range []string{"a.png", "b.txt", "c.txt", "d.txt"} {
+			upload, err := app.cdn.UploadAsset(context.Background(), filepath.Join(dir, "cdn", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			uploads[name] = upload.Key
+		}
+
+		variants := app.cdn.VariantKeys(uploads["a.png"])
+		if len(variants) != 1 {
+			t.Fatalf("expected a.png to be uploaded with a variant, got %v", variants)
+		}
+
+		// Object d is uploaded recently, within the grace period
+		old := time.Now().Add(-2 * time.Hour)
+		for _, key := range append([]string{uploads["a.png"], uploads["b.txt"], uploads["c.txt"]}, variants...) {
+			if err := os.Chtimes(filepath.Join(dir, "bucket", key), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		writeTestFile(t, filepath.Join(dir, "posts", "a.md"), "![a](../cdn/a.png)\n")
+		writeTestFile(t, filepath.Join(dir, "posts", "b.md"), "[b](https://cdn.example.com/"+uploads["b.txt"]+")\n")
+
+		app.params.DryRun = true
+		if err := app.CdnGc(context.Background()); err != nil {
+			t.Fatalf("%v: dry run: %v", test.name, err)
+		}
+
+		planPath := app.ResolveRelativePath(app.config.Cdn.Gc.PlanPath)
+		plan, err := readGcPlan(planPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(plan.Objects) != 1 || plan.Objects[0].Key != uploads["c.txt"] {
+			t.Errorf("%v: expected only %v to be planned for deletion but got %v", test.name, uploads["c.txt"], plan.Objects)
+		}
+
+		if test.referenced {
+			writeTestFile(t, filepath.Join(dir, "posts", "c.md"), "[c](https://cdn.example.com/"+uploads["c.txt"]+")\n")
+		}
+
+		if test.planAge > 0 {
+			plan.CreatedAt = time.Now().Add(-test.planAge)
+			if err := writeGcPlan(planPath, plan); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		app.params.DryRun = false
+		err = app.CdnGc(context.Background())
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: expected error %q but got %v", test.name, test.err, err)
+		}
+
+		for _, key := range append([]string{uploads["a.png"], uploads["b.txt"], uploads["c.txt"], uploads["d.txt"]}, variants...) {
+			_, err := os.Stat(filepath.Join(dir, "bucket", key))
+			if deleted := os.IsNotExist(err); deleted != (test.deleted && key == uploads["c.txt"]) {
+				t.Errorf("%v: expected %v to be deleted %v", test.name, key, !deleted)
+			}
+		}
+
+		if _, err := os.Stat(planPath); os.IsNotExist(err) != (test.err == "") {
+			t.Errorf("%v: expected plan to be removed only after successful run", test.name)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mtratsiuk/b3/pkg/git"
+)
+
+// checkUncommitted refuses to rewrite posts with uncommitted changes,
+// which would be mixed with the rewrite and couldn't be restored with git
+func (app *App) checkUncommitted(posts []postAssets) error {
+	if app.params.Force {
+		return nil
+	}
+
+	repo, toplevel, err := app.openRootRepo()
+	if err != nil {
+		app.log.Debug(fmt.Sprintf("checkUncommitted: skipping, blog is not in a git repository: %v", err))
+		return nil
+	}
+	defer repo.Close()
+
+	uncommitted := make([]string, 0)
+
+	for _, p := range posts {
+		rel, err := repoRelPath(toplevel, p.filePath)
+		if err != nil {
+			return err
+		}
+
+		modified, err := repo.Modified(rel)
+		if err != nil {
+			return fmt.Errorf("failed to check status of %v: %v", rel, err)
+		}
+
+		if modified {
+			uncommitted = append(uncommitted, rel)
+		}
+	}
+
+	if len(uncommitted) > 0 {
+		return fmt.Errorf("posts have uncommitted changes, commit them first or use -force: %v", strings.Join(uncommitted, ", "))
+	}
+
+	return nil
+}
+
+// commitCdnChanges commits rewritten posts and the manifest with `cdn.commit_message`
+func (app *App) commitCdnChanges(updates []postUpdate) error {
+	if app.config.Cdn.CommitMessage == "" {
+		return nil
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("`cdn.commit_message` requires git executable: %v", err)
+	}
+
+	repo, toplevel, err := app.openRootRepo()
+	if err != nil {
+		return fmt.Errorf("failed to find git repository: %v", err)
+	}
+	defer repo.Close()
+
+	paths := make([]string, 0, len(updates)+1)
+	for _, u := range updates {
+		paths = append(paths, u.filePath)
+	}
+
+	manifestPath := app.ResolveRelativePath(app.config.Cdn.ManifestPath)
+	if rel, err := repoRelPath(toplevel, manifestPath); err == nil && !strings.HasPrefix(rel, "..") {
+		paths = append(paths, manifestPath)
+	}
+
+	for idx, p := range paths {
+		rel, err := repoRelPath(toplevel, p)
+		if err != nil {
+			return err
+		}
+		paths[idx] = rel
+	}
+
+	committed, err := git.NewCli(toplevel).Commit(app.config.Cdn.CommitMessage, paths)
+	if err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+
+	if committed {
+		app.log.Info(fmt.Sprintf("commitCdnChanges: committed %v", strings.Join(paths, ", ")))
+	}
+
+	return nil
+}
+
+func (app *App) openRootRepo() (git.Repo, string, error) {
+	repo, err := git.Open(app.params.RootPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	toplevel, err := repo.Toplevel()
+	if err != nil {
+		repo.Close()
+		return nil, "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(toplevel); err == nil {
+		toplevel = resolved
+	}
+
+	return repo, toplevel, nil
+}
+
+// repoRelPath returns slash-separated path of the file relative to the repository's toplevel
+func repoRelPath(toplevel string, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(abs)
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+
+	rel, err := filepath.Rel(toplevel, filepath.Join(dir, filepath.Base(abs)))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
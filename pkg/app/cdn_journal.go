@@ -0,0 +1,261 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mtratsiuk/b3/pkg/utils"
+)
+
+const (
+	JOURNAL_FILE_NAME = "journal.json"
+
+	// Posts are being replaced, or the run failed before replacing all of them
+	JOURNAL_PENDING     = "pending"
+	JOURNAL_COMMITTED   = "committed"
+	JOURNAL_ROLLED_BACK = "rolled_back"
+)
+
+// cdnJournal records posts rewritten by the last `-mode cdn` run, together with
+// backups of their original content kept in the backup directory
+type cdnJournal struct {
+	State     string        `json:"state"`
+	StartedAt time.Time     `json:"started_at"`
+	Files     []journalFile `json:"files"`
+}
+
+type journalFile struct {
+	Path   string `json:"path"`   // relative to the blog's root
+	Backup string `json:"backup"` // relative to the backup directory
+	Before string `json:"before"` // sha256 of the original content
+	After  string `json:"after"`  // sha256 of the rewritten content
+}
+
+type postUpdate struct {
+	filePath string
+	before   []byte
+	after    []byte
+}
+
+// rewritePosts replaces content of all the posts, or none of them. Originals are backed up
+// first, then rewritten posts are staged next to the originals and renamed over them
+func (app *App) rewritePosts(updates []postUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	dirPath := app.ResolveRelativePath(app.config.Cdn.BackupDirPath)
+
+	if err := checkJournal(dirPath); err != nil {
+		return fmt.Errorf("rewritePosts: %v", err)
+	}
+
+	// Only the last run is kept
+	if err := os.RemoveAll(dirPath); err != nil {
+		return fmt.Errorf("rewritePosts: failed to clean backup directory: %v", err)
+	}
+
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return fmt.Errorf("rewritePosts: failed to create backup directory: %v", err)
+	}
+
+	journal := cdnJournal{State: JOURNAL_PENDING, StartedAt: time.Now().UTC()}
+
+	for idx, u := range updates {
+		rel, err := filepath.Rel(app.params.RootPath, u.filePath)
+		if err != nil {
+			return fmt.Errorf("rewritePosts: %v", err)
+		}
+
+		f := journalFile{
+			Path:   filepath.ToSlash(rel),
+			Backup: fmt.Sprintf("%03d-%v", idx, filepath.Base(u.filePath)),
+			Before: contentSha256(u.before),
+			After:  contentSha256(u.after),
+		}
+
+		if err := os.WriteFile(filepath.Join(dirPath, f.Backup), u.before, 0644); err != nil {
+			return fmt.Errorf("rewritePosts: failed to back up %v: %v", u.filePath, err)
+		}
+
+		journal.Files = append(journal.Files, f)
+	}
+
+	if err := writeJournal(dirPath, journal); err != nil {
+		return fmt.Errorf("rewritePosts: %v", err)
+	}
+
+	staged := make([]string, 0, len(updates))
+	removeStaged := func() {
+		for _, s := range staged {
+			os.Remove(s)
+		}
+	}
+
+	for _, u := range updates {
+		tmp := u.filePath + ".b3-tmp"
+		staged = append(staged, tmp)
+
+		if err := os.WriteFile(tmp, u.after, 0644); err != nil {
+			removeStaged()
+			return fmt.Errorf("rewritePosts: failed to write updated post %v, no posts were changed: %v", u.filePath, err)
+		}
+	}
+
+	for idx, u := range updates {
+		if err := os.Rename(staged[idx], u.filePath); err != nil {
+			removeStaged()
+
+			if rollbackErr := app.restorePosts(dirPath, journal); rollbackErr != nil {
+				return fmt.Errorf("rewritePosts: failed to replace %v: %v, and failed to restore replaced posts: %v", u.filePath, err, rollbackErr)
+			}
+
+			return fmt.Errorf("rewritePosts: failed to replace %v, no posts were changed: %v", u.filePath, err)
+		}
+	}
+
+	journal.State = JOURNAL_COMMITTED
+	if err := writeJournal(dirPath, journal); err != nil {
+		return fmt.Errorf("rewritePosts: %v", err)
+	}
+
+	return nil
+}
+
+// CdnRollback restores posts rewritten by the last `-mode cdn` run from their backups.
+// Posts changed after the run are not restored
+func (app *App) CdnRollback() error {
+	if app.params.Ref != "" {
+		return fmt.Errorf("app.CdnRollback: posts can't be updated when reading sources from git ref")
+	}
+
+	dirPath := app.ResolveRelativePath(app.config.Cdn.BackupDirPath)
+
+	journal, err := readJournal(dirPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("app.CdnRollback: nothing to roll back, %v doesn't exist", filepath.Join(dirPath, JOURNAL_FILE_NAME))
+	}
+	if err != nil {
+		return fmt.Errorf("app.CdnRollback: %v", err)
+	}
+
+	if journal.State == JOURNAL_ROLLED_BACK {
+		app.log.Info(fmt.Sprintf("app.CdnRollback: run started at %v is already rolled back", journal.StartedAt))
+		return nil
+	}
+
+	if err := app.restorePosts(dirPath, journal); err != nil {
+		return fmt.Errorf("app.CdnRollback: %v", err)
+	}
+
+	return nil
+}
+
+// restorePosts restores posts which still have the rewritten content and marks the journal rolled back
+func (app *App) restorePosts(dirPath string, journal cdnJournal) error {
+	errs := make([]error, 0)
+
+	for _, f := range journal.Files {
+		path := app.ResolveRelativePath(filepath.FromSlash(f.Path))
+
+		current, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read %v: %v", f.Path, err))
+			continue
+		}
+
+		switch contentSha256(current) {
+		case f.Before:
+			app.log.Debug(fmt.Sprintf("restorePosts: %v is not rewritten", f.Path))
+			continue
+		case f.After:
+		default:
+			errs = append(errs, fmt.Errorf("%v is changed after the run, not restoring it, its backup is %v", f.Path, filepath.Join(dirPath, f.Backup)))
+			continue
+		}
+
+		backup, err := os.ReadFile(filepath.Join(dirPath, f.Backup))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read backup of %v: %v", f.Path, err))
+			continue
+		}
+
+		if contentSha256(backup) != f.Before {
+			errs = append(errs, fmt.Errorf("backup of %v is corrupted", f.Path))
+			continue
+		}
+
+		if err := utils.WriteFileAtomic(path, backup); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %v: %v", f.Path, err))
+			continue
+		}
+
+		app.log.Info(fmt.Sprintf("restorePosts: restored %v", f.Path))
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	journal.State = JOURNAL_ROLLED_BACK
+	return writeJournal(dirPath, journal)
+}
+
+// checkJournal returns error if the last run didn't complete replacing or restoring posts,
+// so that backups of its originals are not removed before the posts are rolled back
+func checkJournal(dirPath string) error {
+	journal, err := readJournal(dirPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if journal.State == JOURNAL_PENDING {
+		return fmt.Errorf(
+			"posts rewritten by the run started at %v may be partially replaced, "+
+				"restore them with `-mode cdn-rollback` before uploading again, backups are in %v",
+			journal.StartedAt, dirPath,
+		)
+	}
+
+	return nil
+}
+
+func readJournal(dirPath string) (cdnJournal, error) {
+	var journal cdnJournal
+
+	data, err := os.ReadFile(filepath.Join(dirPath, JOURNAL_FILE_NAME))
+	if err != nil {
+		return journal, err
+	}
+
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return journal, fmt.Errorf("failed to parse journal: %v", err)
+	}
+
+	return journal, nil
+}
+
+func writeJournal(dirPath string, journal cdnJournal) error {
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileAtomic(filepath.Join(dirPath, JOURNAL_FILE_NAME), append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+
+	return nil
+}
+
+func contentSha256(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
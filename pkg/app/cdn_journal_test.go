@@ -0,0 +1,144 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRewritePosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []string // names of updated posts
+		pending bool     // journal of the previous run is pending
+		err     string
+		state   string // of the journal after the run
+		updated bool
+	}{
+		{"all posts replaced", []string{"a.md", "b.md"}, false, "", JOURNAL_COMMITTED, true},
+		// Staged file of the post updated twice is already moved by the first rename
+		{"rename failed", []string{"a.md", "b.md", "a.md"}, false, "no posts were changed", JOURNAL_ROLLED_BACK, false},
+		{"previous run pending", []string{"a.md", "b.md"}, true, "cdn-rollback", JOURNAL_PENDING, false},
+	}
+
+	for _, test := range tests {
+		app := newTestApp(t, "{}")
+		backupDirPath := app.ResolveRelativePath(app.config.Cdn.BackupDirPath)
+
+		if test.pending {
+			writeTestFile(t, filepath.Join(backupDirPath, "000-a.md"), "previous backup")
+			if err := writeJournal(backupDirPath, cdnJournal{State: JOURNAL_PENDING, StartedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		updates := make([]postUpdate, 0)
+		for _, name := range test.updates {
+			path := app.ResolveRelativePath(name)
+			writeTestFile(t, path, "before "+name)
+			updates = append(updates, postUpdate{path, []byte("before " + name), []byte("after " + name)})
+		}
+
+		err := app.rewritePosts(updates)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v: expected error %q but got %v", test.name, test.err, err)
+		}
+
+		for _, name := range []string{"a.md", "b.md"} {
+			expected := "before " + name
+			if test.updated {
+				expected = "after " + name
+			}
+
+			if content := readTestFile(t, app.ResolveRelativePath(name)); content != expected {
+				t.Errorf("%v: expected %v to be %q but got %q", test.name, name, expected, content)
+			}
+		}
+
+		journal, err := readJournal(backupDirPath)
+		if err != nil || journal.State != test.state {
+			t.Errorf("%v: expected journal state %v but got %v, %v", test.name, test.state, journal.State, err)
+		}
+
+		if test.pending && readTestFile(t, filepath.Join(backupDirPath, "000-a.md")) != "previous backup" {
+			t.Errorf("%v: expected backups of the pending run to be kept", test.name)
+		}
+
+		if staged, _ := filepath.Glob(app.ResolveRelativePath("*.b3-tmp")); len(staged) > 0 {
+			t.Errorf("%v: expected staged posts to be removed but got %v", test.name, staged)
+		}
+	}
+}
+
+func TestCdnRollback(t *testing.T) {
+	app := newTestApp(t, "{}")
+	a, b := app.ResolveRelativePath("a.md"), app.ResolveRelativePath("b.md")
+	writeTestFile(t, a, "before a")
+	writeTestFile(t, b, "before b")
+
+	err := app.rewritePosts([]postUpdate{
+		{a, []byte("before a"), []byte("after a")},
+		{b, []byte("before b"), []byte("after b")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, b, "edited b")
+
+	if err := app.CdnRollback(); err == nil || !strings.Contains(err.Error(), "b.md is changed after the run") {
+		t.Errorf("expected post changed after the run not to be restored, got error %v", err)
+	}
+
+	if content := readTestFile(t, a); content != "before a" {
+		t.Errorf("expected a.md to be restored but got %q", content)
+	}
+	if content := readTestFile(t, b); content != "edited b" {
+		t.Errorf("expected b.md to be kept but got %q", content)
+	}
+
+	// Rollback is incomplete, so it can be repeated after resolving the conflict
+	journal, err := readJournal(app.ResolveRelativePath(app.config.Cdn.BackupDirPath))
+	if err != nil || journal.State != JOURNAL_COMMITTED {
+		t.Errorf("expected journal state %v but got %v, %v", JOURNAL_COMMITTED, journal.State, err)
+	}
+}
+
+// newTestApp returns app of the blog in a temporary directory configured by `b3.json` content
+func newTestApp(t *testing.T, cfg string) *App {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "b3.json"), cfg)
+
+	app, err := New(Params{
+		Log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		RootPath: dir,
+		Out:      io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &app
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
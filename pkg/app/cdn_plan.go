@@ -0,0 +1,184 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/mtratsiuk/b3/pkg/cdn"
+	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/diff"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+type planReport struct {
+	Assets   []planAsset   `json:"assets"`
+	Rewrites []planRewrite `json:"rewrites"` // empty if urls are substituted while building
+}
+
+type planAsset struct {
+	Post        string `json:"post"`
+	Path        string `json:"path"`
+	Key         string `json:"key"`
+	Url         string `json:"url"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type"`
+	Sha256      string `json:"sha256"`
+	Uploaded    bool   `json:"uploaded"`
+}
+
+type planRewrite struct {
+	Post string `json:"post"`
+	Diff string `json:"diff"`
+}
+
+// planAssets reports assets which would be uploaded and diffs of the posts which would be rewritten
+func (app *App) planAssets(posts []postAssets, paths []string) error {
+	uploads := make(map[string]assetUpload, len(paths))
+	plans := make(map[string]cdn.Plan, len(paths))
+
+	for _, path := range paths {
+		plan, err := app.cdn.PlanAsset(path)
+		if err != nil {
+			return fmt.Errorf("uploadAssets: %v", err)
+		}
+
+		plans[path] = plan
+		uploads[path] = assetUpload{upload: plan.Upload}
+	}
+
+	report := planReport{Assets: make([]planAsset, 0), Rewrites: make([]planRewrite, 0)}
+
+	for _, p := range posts {
+		seen := make(map[string]bool)
+
+		for _, ref := range p.refs {
+			path := p.paths[ref.Start]
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			plan := plans[path]
+			report.Assets = append(report.Assets, planAsset{
+				Post:        app.rootRelPath(p.filePath),
+				Path:        app.rootRelPath(path),
+				Key:         plan.Key,
+				Url:         plan.Url,
+				Size:        plan.Size,
+				ContentType: plan.ContentType,
+				Sha256:      plan.Sha256,
+				Uploaded:    plan.Status != cdn.PLANNED,
+			})
+		}
+	}
+
+	if app.config.Cdn.UrlSubstitution == config.CDN_URLS_SOURCE {
+		for _, u := range postUpdates(posts, uploads) {
+			name := app.rootRelPath(u.filePath)
+			report.Rewrites = append(report.Rewrites, planRewrite{
+				Post: name,
+				Diff: diff.Unified("a/"+name, "b/"+name, string(u.before), string(u.after), 3),
+			})
+		}
+	}
+
+	switch app.params.Format {
+	case FORMAT_JSON:
+		return app.printPlanJson(report)
+	case FORMAT_TEXT, "":
+		return app.printPlanText(report, plans)
+	default:
+		return fmt.Errorf("uploadAssets: unexpected format: %v", app.params.Format)
+	}
+}
+
+func (app *App) printPlanJson(report planReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("printPlanJson: %v", err)
+	}
+
+	_, err = fmt.Fprintln(app.params.Out, string(data))
+	return err
+}
+
+func (app *App) printPlanText(report planReport, plans map[string]cdn.Plan) error {
+	w := tabwriter.NewWriter(app.params.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "POST\tASSET\tKEY\tURL\tSIZE\tTYPE\tSTATUS")
+	for _, a := range report.Assets {
+		status := cdn.PLANNED
+		if a.Uploaded {
+			status = "uploaded"
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", a.Post, a.Path, a.Key, a.Url, formatSize(a.Size), a.ContentType, status)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	planned, plannedSize := 0, 0
+	for _, plan := range plans {
+		if plan.Status == cdn.PLANNED {
+			planned += 1
+			plannedSize += plan.Size
+		}
+	}
+
+	fmt.Fprintf(
+		app.params.Out, "\n%v assets: %v to upload (%v), %v already uploaded, %v posts to rewrite\n",
+		len(plans), planned, formatSize(plannedSize), len(plans)-planned, len(report.Rewrites),
+	)
+
+	for _, r := range report.Rewrites {
+		fmt.Fprint(app.params.Out, "\n"+r.Diff)
+	}
+
+	return nil
+}
+
+// rootRelPath returns slash-separated path relative to the blog's root
+func (app *App) rootRelPath(path string) string {
+	root, err := filepath.Abs(app.params.RootPath)
+	if err != nil {
+		return path
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+func formatSize(size int) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%v B", size)
+	}
+
+	value := float64(size) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %v", value, suffix)
+		}
+		value /= unit
+	}
+
+	return fmt.Sprintf("%.1f TB", value)
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtratsiuk/b3/pkg/cdn"
+)
+
+func TestPlanAssets(t *testing.T) {
+	tests := []struct {
+		substitution string
+		format       string
+		rewrites     int
+		err          string
+	}{
+		{"source", FORMAT_JSON, 2, ""},
+		{"build", FORMAT_JSON, 0, ""},
+		{"source", FORMAT_TEXT, 2, ""},
+		{"build", "", 0, ""},
+		{"source", "yaml", 0, "unexpected format: yaml"},
+	}
+
+	posts := map[string]string{
+		"a.md": "# A\n\n![uploaded](../cdn/uploaded.txt)\n![new](../cdn/new.txt)\n",
+		"b.md": "# B\n\n[new](../cdn/new.txt)\n",
+	}
+
+	for idx, test := range tests {
+		app := newTestApp(t, fmt.Sprintf(`{
+			"posts_glob": ["./posts/*"],
+			"assets_to_upload_regexp": "^\\.\\./cdn/",
+			"cdn": {
+				"backend": "local",
+				"key_prefix": "assets",
+				"url_substitution": "%v",
+				"local": {"dir_path": "./bucket", "public_url": "https://cdn.example.com"}
+			}
+		}`, test.substitution))
+		dir := app.params.RootPath
+
+		for name, content := range posts {
+			writeTestFile(t, filepath.Join(dir, "posts", name), content)
+		}
+		for _, name := range []string{"uploaded.txt", "new.txt"} {
+			writeTestFile(t, filepath.Join(dir, "cdn", name), name)
+		}
+
+		if _, err := app.cdn.UploadAsset(context.Background(), filepath.Join(dir, "cdn", "uploaded.txt")); err != nil {
+			t.Fatal(err)
+		}
+
+		out := &bytes.Buffer{}
+		app.params.DryRun = true
+		app.params.Format = test.format
+		app.params.Out = out
+
+		err := app.Cdn(context.Background())
+		if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v) Cdn: expected error '%v' but got %v", idx, test.err, err)
+			continue
+		}
+
+		// Dry run neither rewrites posts nor uploads assets
+		for name, content := range posts {
+			if got := readTestFile(t, filepath.Join(dir, "posts", name)); got != content {
+				t.Errorf("%v) Cdn: expected %v to be unchanged but got '%v'", idx, name, got)
+			}
+		}
+		manifest, err := cdn.LoadManifest(app.ResolveRelativePath(app.config.Cdn.ManifestPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asset, ok := manifest.Find(filepath.Join(dir, "cdn", "new.txt"), cdn.AssetSha256([]byte("new.txt"))); ok {
+			t.Errorf("%v) Cdn: expected new.txt not to be uploaded but got %v", idx, asset.Url)
+		}
+
+		if test.err != "" {
+			continue
+		}
+
+		if test.format == FORMAT_JSON {
+			var report planReport
+			if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+				t.Fatalf("%v) Cdn: failed to parse report: %v\n%v", idx, err, out)
+			}
+
+			expected := []struct {
+				post, path string
+				uploaded   bool
+			}{
+				{"posts/a.md", "cdn/uploaded.txt", true},
+				{"posts/a.md", "cdn/new.txt", false},
+				{"posts/b.md", "cdn/new.txt", false},
+			}
+
+			if len(report.Assets) != len(expected) {
+				t.Fatalf("%v) Cdn: expected %v assets but got %+v", idx, len(expected), report.Assets)
+			}
+
+			for i, e := range expected {
+				a := report.Assets[i]
+				content := filepath.Base(e.path)
+
+				if a.Post != e.post || a.Path != e.path || a.Uploaded != e.uploaded {
+					t.Errorf("%v) Cdn: expected asset %+v but got %+v", idx, e, a)
+				}
+				if a.Size != len(content) || a.Sha256 != cdn.AssetSha256([]byte(content)) || !strings.HasPrefix(a.ContentType, "text/plain") {
+					t.Errorf("%v) Cdn: unexpected metadata of %v: %+v", idx, e.path, a)
+				}
+				if !strings.HasPrefix(a.Key, "assets/") || a.Url != "https://cdn.example.com/"+a.Key {
+					t.Errorf("%v) Cdn: unexpected key or url of %v: %+v", idx, e.path, a)
+				}
+			}
+
+			if len(report.Rewrites) != test.rewrites {
+				t.Fatalf("%v) Cdn: expected %v rewrites but got %+v", idx, test.rewrites, report.Rewrites)
+			}
+
+			for _, r := range report.Rewrites {
+				if !strings.Contains(r.Diff, "-[new](../cdn/new.txt)") && !strings.Contains(r.Diff, "-![new](../cdn/new.txt)") {
+					t.Errorf("%v) Cdn: expected diff of %v to replace new.txt but got:\n%v", idx, r.Post, r.Diff)
+				}
+			}
+
+			continue
+		}
+
+		text := out.String()
+		summary := fmt.Sprintf("2 assets: 1 to upload (7 B), 1 already uploaded, %v posts to rewrite", test.rewrites)
+
+		if !strings.HasPrefix(text, "POST ") || !strings.Contains(text, summary) {
+			t.Errorf("%v) Cdn: expected header and summary '%v' but got:\n%v", idx, summary, text)
+		}
+		if got := strings.Count(text, "--- a/posts/"); got != test.rewrites {
+			t.Errorf("%v) Cdn: expected %v diffs but got %v:\n%v", idx, test.rewrites, got, text)
+		}
+	}
+}
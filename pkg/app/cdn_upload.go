@@ -0,0 +1,233 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/mtratsiuk/b3/pkg/cdn"
+	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/markdown"
+	"github.com/mtratsiuk/b3/pkg/utils"
+)
+
+// postAssets is a markdown file referencing assets meant to be uploaded to CDN
+type postAssets struct {
+	filePath string
+	content  []byte
+	refs     []markdown.Ref // positions are relative to the whole file, including front matter
+	paths    map[int]string // asset paths by start of their refs
+}
+
+type assetUpload struct {
+	upload cdn.Upload
+	err    error
+}
+
+// uploadAssets uploads assets referenced by posts and pages, and replaces their paths
+// with public urls. Posts are rewritten only after all the assets are uploaded, so that
+// interrupted or partially failed runs leave posts unchanged and can be safely repeated
+func (app *App) uploadAssets(ctx context.Context) error {
+	if app.config.AssetsToUploadRegexp == "" {
+		app.log.Debug("uploadAssets: nothing to do, `assets_to_upload_regexp` is not defined")
+		return nil
+	}
+
+	posts, err := app.findPostAssets()
+	if err != nil {
+		return fmt.Errorf("uploadAssets: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	paths := make([]string, 0)
+	for _, p := range posts {
+		for _, ref := range p.refs {
+			if path := p.paths[ref.Start]; !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	if app.params.DryRun {
+		return app.planAssets(posts, paths)
+	}
+
+	rewrite := app.config.Cdn.UrlSubstitution == config.CDN_URLS_SOURCE
+
+	if rewrite {
+		if err := app.checkUncommitted(posts); err != nil {
+			return fmt.Errorf("uploadAssets: %v", err)
+		}
+
+		if err := checkJournal(app.ResolveRelativePath(app.config.Cdn.BackupDirPath)); err != nil {
+			return fmt.Errorf("uploadAssets: %v", err)
+		}
+	}
+
+	uploads := app.uploadAssetFiles(ctx, paths)
+
+	errs := make([]error, 0)
+	for _, path := range paths {
+		if err := uploads[path].err; err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", app.relativeToRoot(path), err))
+		}
+	}
+
+	// Uploaded assets are recorded in the manifest, so they're skipped when the run is repeated
+	if ctx.Err() != nil {
+		return fmt.Errorf("uploadAssets: interrupted, %v of %v assets are not uploaded, no posts were changed", len(errs), len(paths))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("uploadAssets: failed to upload %v of %v assets, no posts were changed: %v", len(errs), len(paths), errors.Join(errs...))
+	}
+
+	updates := make([]postUpdate, 0, len(posts))
+
+	// Urls are substituted from the manifest while building
+	if rewrite {
+		updates = postUpdates(posts, uploads)
+	}
+
+	if err := app.rewritePosts(updates); err != nil {
+		return fmt.Errorf("uploadAssets: %v", err)
+	}
+
+	if err := app.commitCdnChanges(updates); err != nil {
+		return fmt.Errorf("uploadAssets: %v", err)
+	}
+
+	return nil
+}
+
+func postUpdates(posts []postAssets, uploads map[string]assetUpload) []postUpdate {
+	updates := make([]postUpdate, 0, len(posts))
+
+	for _, p := range posts {
+		if updated := p.rewrite(uploads); !bytes.Equal(updated, p.content) {
+			updates = append(updates, postUpdate{p.filePath, p.content, updated})
+		}
+	}
+
+	return updates
+}
+
+func (app *App) findPostAssets() ([]postAssets, error) {
+	uploadRe := regexp.MustCompile(app.config.AssetsToUploadRegexp)
+
+	sources, err := app.matchPostSources(append(app.config.PostsGlobs(), app.config.PagesGlob...))
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]postAssets, 0, len(sources))
+
+	for _, src := range sources {
+		app.log.Debug(fmt.Sprintf("findPostAssets: processing file %v", src.FilePath))
+
+		content, err := os.ReadFile(src.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed read post file: %v", err)
+		}
+
+		_, body, err := utils.ParseFrontMatter(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse front matter of %v: %v", src.FilePath, err)
+		}
+		offset := len(content) - len(body)
+
+		post := postAssets{filePath: src.FilePath, content: content, paths: make(map[int]string)}
+
+		for _, ref := range markdown.Refs(body) {
+			if !uploadRe.MatchString(ref.Dest) {
+				app.log.Debug(fmt.Sprintf("findPostAssets: skipping %v: %v", ref.Kind, ref.Dest))
+				continue
+			}
+
+			app.log.Debug(fmt.Sprintf("findPostAssets: found %v: %v", ref.Kind, ref.Dest))
+
+			ref.Start += offset
+			ref.Stop += offset
+			post.refs = append(post.refs, ref)
+			post.paths[ref.Start] = filepath.Join(filepath.Dir(src.FilePath), filepath.FromSlash(ref.Dest))
+		}
+
+		if len(post.refs) > 0 {
+			posts = append(posts, post)
+		}
+	}
+
+	return posts, nil
+}
+
+// uploadAssetFiles uploads assets in parallel, reporting progress as uploads finish.
+// Assets which are not started before `ctx` is done fail with its error
+func (app *App) uploadAssetFiles(ctx context.Context, paths []string) map[string]assetUpload {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	results := make(map[string]assetUpload, len(paths))
+	counts := make(map[string]int)
+	slots := make(chan struct{}, app.config.Cdn.Concurrency)
+
+	for _, path := range paths {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+			}
+
+			var result assetUpload
+			if err := ctx.Err(); err != nil {
+				result.err = err
+			} else {
+				result.upload, result.err = app.cdn.UploadAsset(ctx, path)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results[path] = result
+			progress := fmt.Sprintf("[%v/%v]", len(results), len(paths))
+
+			if result.err != nil {
+				counts["failed"] += 1
+				app.log.Warn(fmt.Sprintf("uploadAssets: %v failed to upload %v: %v", progress, app.relativeToRoot(path), result.err))
+				return
+			}
+
+			counts[result.upload.Status] += 1
+			app.log.Info(fmt.Sprintf("uploadAssets: %v %v %v: %v", progress, result.upload.Status, app.relativeToRoot(path), result.upload.Url))
+		}()
+	}
+
+	wg.Wait()
+
+	app.log.Info(fmt.Sprintf(
+		"uploadAssets: %v assets: %v uploaded, %v skipped, %v failed",
+		len(paths),
+		counts[cdn.UPLOADED],
+		counts[cdn.SKIPPED_MANIFEST]+counts[cdn.SKIPPED_EXISTS],
+		counts["failed"],
+	))
+
+	return results
+}
+
+// rewrite replaces paths of the assets with their public urls
+func (p postAssets) rewrite(uploads map[string]assetUpload) []byte {
+	return markdown.Rewrite(p.content, p.refs, func(ref markdown.Ref) (string, bool) {
+		return uploads[p.paths[ref.Start]].upload.Url, true
+	})
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/mtratsiuk/b3/pkg/cdn"
+	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/markdown"
+)
+
+// Directory in the out directory with copies of assets which are not uploaded to CDN yet
+const CDN_FALLBACK_DIR_NAME = "_cdn"
+
+// cdnUrls replaces local paths of assets meant to be uploaded to CDN with their
+// public urls from the upload manifest, so that markdown sources keep local paths.
+// Assets which are not uploaded yet are copied to the out directory instead
+type cdnUrls struct {
+	app         *App
+	uploadRe    *regexp.Regexp
+	srcDirPath  string // directory asset paths are relative to
+	htmlDirPath string // directory of the rendered html file
+}
+
+func (app *App) newCdnUrls(srcDirPath, htmlDirPath string) *cdnUrls {
+	if app.manifest == nil || app.config.Cdn.UrlSubstitution != config.CDN_URLS_BUILD {
+		return nil
+	}
+
+	return &cdnUrls{
+		app:         app,
+		uploadRe:    regexp.MustCompile(app.config.AssetsToUploadRegexp),
+		srcDirPath:  srcDirPath,
+		htmlDirPath: htmlDirPath,
+	}
+}
+
+// rewrite replaces destinations of assets in markdown source, leaving the rest of the source intact
+func (c *cdnUrls) rewrite(source []byte) ([]byte, error) {
+	var errs []error
+
+	rewritten := markdown.Rewrite(source, markdown.Refs(source), func(ref markdown.Ref) (string, bool) {
+		if !c.uploadRe.MatchString(ref.Dest) {
+			return "", false
+		}
+
+		url, err := c.url(ref.Dest)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to resolve cdn url of %v: %v", ref.Dest, err))
+			return "", false
+		}
+
+		return url, true
+	})
+
+	return rewritten, errors.Join(errs...)
+}
+
+func (c *cdnUrls) url(dest string) (string, error) {
+	assetPath := filepath.Join(c.srcDirPath, filepath.FromSlash(dest))
+
+	content, err := c.app.src.ReadFile(assetPath)
+	if err != nil {
+		return "", err
+	}
+
+	if uploaded, ok := c.app.manifest.Find(assetPath, cdn.AssetSha256(content)); ok {
+		c.app.log.Debug(fmt.Sprintf("cdnUrls: using uploaded asset %v: %v", dest, uploaded.Url))
+		return uploaded.Url, nil
+	}
+
+	name := fmt.Sprintf("%x%v", sha256.Sum256(content), path.Ext(dest))
+	copyPath := filepath.Join(c.app.outDirPath, CDN_FALLBACK_DIR_NAME, name)
+
+	if err := os.MkdirAll(filepath.Dir(copyPath), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(copyPath, content, 0644); err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(c.htmlDirPath, copyPath)
+	if err != nil {
+		return "", err
+	}
+
+	c.app.log.Warn(fmt.Sprintf("cdnUrls: asset %v is not uploaded to cdn yet, using local copy", assetPath))
+
+	return filepath.ToSlash(rel), nil
+}
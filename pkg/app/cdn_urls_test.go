@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtratsiuk/b3/pkg/cdn"
+)
+
+func TestCdnUrls(t *testing.T) {
+	app := newTestApp(t, `{
+		"assets_to_upload_regexp": "^\\.\\./cdn/",
+		"cdn": {
+			"backend": "local",
+			"url_substitution": "build",
+			"local": {"dir_path": "./bucket", "public_url": "https://cdn.example.com"}
+		}
+	}`)
+	dir := app.params.RootPath
+
+	for _, name := range []string{"uploaded.txt", "changed.txt", "local.txt"} {
+		writeTestFile(t, filepath.Join(dir, "cdn", name), name)
+	}
+
+	urls := make(map[string]string)
+	for _, name := range []string{"uploaded.txt", "changed.txt"} {
+		upload, err := app.cdn.UploadAsset(context.Background(), filepath.Join(dir, "cdn", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls[name] = upload.Url
+	}
+
+	// Asset changed after upload is not substituted with the outdated url
+	writeTestFile(t, filepath.Join(dir, "cdn", "changed.txt"), "changed after upload")
+
+	manifest, err := cdn.LoadManifest(app.ResolveRelativePath(app.config.Cdn.ManifestPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.manifest = manifest
+
+	fallback := func(content string) string {
+		return fmt.Sprintf("%v/%x.txt", CDN_FALLBACK_DIR_NAME, sha256.Sum256([]byte(content)))
+	}
+
+	tests := []struct {
+		htmlDir  string // relative to the out directory
+		dest     string
+		expected string
+		copied   string // content of the local copy
+		err      string
+	}{
+		{"posts", "../cdn/uploaded.txt", urls["uploaded.txt"], "", ""},
+		{"posts", "../cdn/changed.txt", "../" + fallback("changed after upload"), "changed after upload", ""},
+		{"posts", "../cdn/local.txt", "../" + fallback("local.txt"), "local.txt", ""},
+		{"blog/2024", "../cdn/local.txt", "../../" + fallback("local.txt"), "local.txt", ""},
+		{".", "../cdn/local.txt", fallback("local.txt"), "local.txt", ""},
+		// Destinations not matching `assets_to_upload_regexp` are kept
+		{"posts", "../assets/a.png", "../assets/a.png", "", ""},
+		{"posts", "../cdn/missing.txt", "", "", "failed to resolve cdn url of ../cdn/missing.txt"},
+	}
+
+	for idx, test := range tests {
+		urls := app.newCdnUrls(filepath.Join(dir, "posts"), filepath.Join(app.outDirPath, filepath.FromSlash(test.htmlDir)))
+
+		got, err := urls.rewrite([]byte("![a](" + test.dest + ")"))
+		if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v) rewrite(%v): expected error '%v' but got %v", idx, test.dest, test.err, err)
+			continue
+		}
+		if test.err != "" {
+			continue
+		}
+
+		if string(got) != "![a]("+test.expected+")" {
+			t.Errorf("%v) rewrite(%v): expected '%v' but got '%s'", idx, test.dest, test.expected, got)
+		}
+
+		if test.copied != "" {
+			copyPath := filepath.Join(app.outDirPath, filepath.FromSlash(test.htmlDir), filepath.FromSlash(test.expected))
+			if content, err := os.ReadFile(copyPath); err != nil || string(content) != test.copied {
+				t.Errorf("%v) rewrite(%v): expected local copy '%v' but got '%s', %v", idx, test.dest, test.copied, content, err)
+			}
+		}
+	}
+
+	// Urls are substituted only in build mode
+	app.config.Cdn.UrlSubstitution = "source"
+	if urls := app.newCdnUrls(filepath.Join(dir, "posts"), app.outDirPath); urls != nil {
+		t.Errorf("newCdnUrls: expected no substitution in source mode")
+	}
+}
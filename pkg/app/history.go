@@ -0,0 +1,164 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mtratsiuk/b3/pkg/diff"
+	"github.com/mtratsiuk/b3/pkg/templates"
+	"github.com/mtratsiuk/b3/pkg/timestamper"
+)
+
+const HISTORY_FILE_NAME = "history.html"
+
+// Number of unchanged lines shown around changes in the history diffs
+const HISTORY_DIFF_CONTEXT_LINES = 3
+
+// historyFilePath returns path of the post's history page, rendered next to the post
+func historyFilePath(post *Post) string {
+	if post.BundleDirPath != "" {
+		return filepath.Join(filepath.Dir(post.HtmlFilePath), HISTORY_FILE_NAME)
+	}
+
+	return strings.TrimSuffix(post.HtmlFilePath, ".html") + "." + HISTORY_FILE_NAME
+}
+
+// historyUrl returns url of the post's history page, or empty string if it's not rendered
+func (app *App) historyUrl(post *Post, fromDirPath string) string {
+	if post.HistoryFilePath == "" {
+		return ""
+	}
+
+	return app.relativeUrl(post.HistoryFilePath, fromDirPath)
+}
+
+// renderHistories renders history pages of posts. History pages are optional, so posts
+// without history, e.g. outside of git repository, are rendered without them
+func (app *App) renderHistories(posts Posts) error {
+	historian, ok := app.timestamper.(timestamper.Historian)
+	if !ok {
+		app.log.Warn("renderHistories: skipping post histories, timestamper doesn't support reading history")
+		for _, post := range posts {
+			post.HistoryFilePath = ""
+		}
+		return nil
+	}
+
+	for _, post := range posts {
+		revisions, err := historian.Revisions(post.FilePath)
+		if errors.Is(err, timestamper.ErrNoHistory) {
+			app.log.Warn(fmt.Sprintf("renderHistories: skipping history of post %v: %v", post.Id, err))
+			post.HistoryFilePath = ""
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("renderHistories: failed to read history of post %v: %v", post.Id, err)
+		}
+
+		if len(revisions) == 0 {
+			app.log.Debug(fmt.Sprintf("renderHistories: skipping history of post %v, it's not committed yet", post.Id))
+			post.HistoryFilePath = ""
+			continue
+		}
+
+		if err := app.renderHistory(post, revisions); err != nil {
+			return fmt.Errorf("renderHistories: failed to render history of post %v: %v", post.Id, err)
+		}
+		app.log.Debug(fmt.Sprintf("renderHistories: rendered history: %v", post.HistoryFilePath))
+	}
+
+	return nil
+}
+
+func (app *App) renderHistory(post *Post, revisions []timestamper.Revision) error {
+	data := templates.HistoryData{
+		Title:       "History: " + string(post.Title),
+		Description: fmt.Sprintf("Revisions of '%v'", post.Title),
+		PostTitle:   post.Title,
+		PostUrl:     app.postUrl(post, filepath.Dir(post.HistoryFilePath)),
+		Revisions:   make([]templates.RevisionData, 0, len(revisions)),
+	}
+
+	for idx, rev := range revisions {
+		prev := ""
+		if idx+1 < len(revisions) {
+			prev = string(revisions[idx+1].Content)
+		}
+
+		subject, _, _ := strings.Cut(strings.TrimSpace(rev.Message), "\n")
+
+		data.Revisions = append(data.Revisions, templates.RevisionData{
+			Hash:       rev.Hash[:min(len(rev.Hash), 7)],
+			AuthorName: rev.AuthorName,
+			Date:       rev.Date,
+			Message:    subject,
+			Diff:       diffData(prev, string(rev.Content)),
+		})
+	}
+
+	if err := os.MkdirAll(filepath.Dir(post.HistoryFilePath), os.ModePerm); err != nil {
+		return err
+	}
+
+	out, err := os.Create(post.HistoryFilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return app.templates.RenderHistory(out, data)
+}
+
+// diffData returns word-level diff of two revisions, with long runs
+// of unchanged lines collapsed
+func diffData(old, new string) []templates.DiffData {
+	chunks := make([]templates.DiffData, 0)
+
+	for _, e := range diff.Diff(diff.Words(old), diff.Words(new)) {
+		inserted, deleted := e.Op == diff.INSERT, e.Op == diff.DELETE
+
+		if last := len(chunks) - 1; last >= 0 && chunks[last].Inserted == inserted && chunks[last].Deleted == deleted {
+			chunks[last].Text += e.Text
+			continue
+		}
+
+		chunks = append(chunks, templates.DiffData{Text: e.Text, Inserted: inserted, Deleted: deleted})
+	}
+
+	data := make([]templates.DiffData, 0, len(chunks))
+
+	for idx, c := range chunks {
+		if c.Inserted || c.Deleted {
+			data = append(data, c)
+			continue
+		}
+
+		lines := diff.Lines(c.Text)
+		head, tail := 0, 0
+		if idx > 0 {
+			head = min(len(lines), HISTORY_DIFF_CONTEXT_LINES+1)
+		}
+		if idx < len(chunks)-1 {
+			tail = min(len(lines)-head, HISTORY_DIFF_CONTEXT_LINES)
+		}
+
+		skipped := len(lines) - head - tail
+		if skipped <= 1 {
+			data = append(data, c)
+			continue
+		}
+
+		if head > 0 {
+			data = append(data, templates.DiffData{Text: strings.Join(lines[:head], "")})
+		}
+		data = append(data, templates.DiffData{Text: fmt.Sprintf("⋯ %v unchanged lines\n", skipped), Skipped: true})
+		if tail > 0 {
+			data = append(data, templates.DiffData{Text: strings.Join(lines[len(lines)-tail:], "")})
+		}
+	}
+
+	return data
+}
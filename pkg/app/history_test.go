@@ -0,0 +1,132 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtratsiuk/b3/pkg/templates"
+	"github.com/mtratsiuk/b3/pkg/timestamper"
+)
+
+func TestDiffData(t *testing.T) {
+	lines := func(from, to int) string {
+		b := strings.Builder{}
+		for i := from; i < to; i++ {
+			fmt.Fprintf(&b, "l%v\n", i)
+		}
+		return b.String()
+	}
+
+	skipped := func(n int) templates.DiffData {
+		return templates.DiffData{Text: fmt.Sprintf("⋯ %v unchanged lines\n", n), Skipped: true}
+	}
+
+	tests := []struct {
+		old      string
+		new      string
+		expected []templates.DiffData
+	}{
+		{"a b\n", "a b\n", []templates.DiffData{{Text: "a b\n"}}},
+		{"a b\n", "a c\n", []templates.DiffData{{Text: "a "}, {Text: "b", Deleted: true}, {Text: "c", Inserted: true}, {Text: "\n"}}},
+		{"", "x\n", []templates.DiffData{{Text: "x\n", Inserted: true}}},
+		// Unchanged lines before the first change are collapsed except for the context
+		{lines(0, 10) + "a\n", lines(0, 10) + "b\n", []templates.DiffData{
+			skipped(7), {Text: lines(7, 10)}, {Text: "a", Deleted: true}, {Text: "b", Inserted: true}, {Text: "\n"},
+		}},
+		// Unchanged lines between changes keep context after the previous change and before the next one
+		{"x\n" + lines(0, 10) + "y\n", "X\n" + lines(0, 10) + "Y\n", []templates.DiffData{
+			{Text: "x", Deleted: true}, {Text: "X", Inserted: true},
+			{Text: "\n" + lines(0, 3)}, skipped(4), {Text: lines(7, 10)},
+			{Text: "y", Deleted: true}, {Text: "Y", Inserted: true}, {Text: "\n"},
+		}},
+		// Single line isn't collapsed
+		{"x\n" + lines(0, 7) + "y\n", "X\n" + lines(0, 7) + "Y\n", []templates.DiffData{
+			{Text: "x", Deleted: true}, {Text: "X", Inserted: true},
+			{Text: "\n" + lines(0, 7)},
+			{Text: "y", Deleted: true}, {Text: "Y", Inserted: true}, {Text: "\n"},
+		}},
+	}
+
+	for idx, test := range tests {
+		if got := diffData(test.old, test.new); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%v) diffData: expected %+v but got %+v", idx, test.expected, got)
+		}
+	}
+}
+
+type testTimestamper struct{}
+
+func (t testTimestamper) CreatedAt(filepath string) (time.Time, error) {
+	return time.Time{}, timestamper.ErrNoTimestamp
+}
+
+func (t testTimestamper) UpdatedAt(filepath string) (time.Time, error) {
+	return time.Time{}, timestamper.ErrNoTimestamp
+}
+
+type testHistorian struct {
+	testTimestamper
+	revisions map[string][]timestamper.Revision
+}
+
+func (h testHistorian) Revisions(filepath string) ([]timestamper.Revision, error) {
+	if filepath == "broken.md" {
+		return nil, errors.New("broken repository")
+	}
+
+	revisions, ok := h.revisions[filepath]
+	if !ok {
+		return nil, timestamper.ErrNoHistory
+	}
+
+	return revisions, nil
+}
+
+func TestRenderHistories(t *testing.T) {
+	historian := testHistorian{revisions: map[string][]timestamper.Revision{
+		"committed.md":   {{Hash: "c1", Message: "init", Content: []byte("# Post\n")}},
+		"uncommitted.md": {},
+	}}
+
+	tests := []struct {
+		timestamper timestamper.Timestamper
+		post        string
+		err         string
+		rendered    bool
+	}{
+		{historian, "committed.md", "", true},
+		{historian, "uncommitted.md", "", false},
+		{historian, "outside-of-repository.md", "", false},
+		{historian, "broken.md", "broken repository", false},
+		// History pages are skipped if timestamper can't read history
+		{testTimestamper{}, "committed.md", "", false},
+	}
+
+	for idx, test := range tests {
+		app := newTestApp(t, "{}")
+		app.timestamper = test.timestamper
+
+		post := &Post{Id: "post", FilePath: test.post, Title: "Post", HtmlFilePath: filepath.Join(app.outDirPath, "post.html")}
+		post.HistoryFilePath = historyFilePath(post)
+		historyPath := post.HistoryFilePath
+
+		err := app.renderHistories(Posts{post.Id: post})
+		if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v) renderHistories(%v): expected error '%v' but got %v", idx, test.post, test.err, err)
+		}
+		if test.err != "" {
+			continue
+		}
+
+		_, statErr := os.Stat(historyPath)
+		if rendered := statErr == nil; rendered != test.rendered || (post.HistoryFilePath != "") != test.rendered {
+			t.Errorf("%v) renderHistories(%v): expected history to be rendered %v but got %v with path '%v'", idx, test.post, test.rendered, rendered, post.HistoryFilePath)
+		}
+	}
+}
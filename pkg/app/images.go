@@ -0,0 +1,137 @@
+package app
+
+import (
+	"crypto/sha256"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mtratsiuk/b3/pkg/cdn"
+	"github.com/mtratsiuk/b3/pkg/images"
+	"github.com/mtratsiuk/b3/pkg/markdown"
+	"github.com/mtratsiuk/b3/pkg/utils"
+)
+
+// imageVariants returns variants of images referenced by markdown file relocated by `r`.
+// Variants of uploaded images are read from the manifest, and variants of local images
+// are written next to the images in the out directory
+func (app *App) imageVariants(r relocation) func(dest string) []markdown.ImageVariant {
+	var uploadRe *regexp.Regexp
+	if app.config.AssetsToUploadRegexp != "" {
+		uploadRe = regexp.MustCompile(app.config.AssetsToUploadRegexp)
+	}
+
+	return func(dest string) []markdown.ImageVariant {
+		if app.manifest != nil {
+			if uploaded, ok := app.manifest.FindUrl(dest); ok {
+				return uploadedImageVariants(uploaded)
+			}
+		}
+
+		// Assets meant to be uploaded to CDN are not copied to the out directory
+		if uploadRe != nil && uploadRe.MatchString(dest) {
+			return nil
+		}
+
+		variants, err := app.localImageVariants(dest, r)
+		if err != nil {
+			app.log.Warn(fmt.Sprintf("imageVariants: skipping variants of %v: %v", dest, err))
+			return nil
+		}
+
+		return variants
+	}
+}
+
+func uploadedImageVariants(uploaded cdn.ManifestAsset) []markdown.ImageVariant {
+	if len(uploaded.Variants) == 0 {
+		return nil
+	}
+
+	variants := make([]markdown.ImageVariant, 0, len(uploaded.Variants)+1)
+	for _, v := range uploaded.Variants {
+		variants = append(variants, markdown.ImageVariant{Url: v.Url, Width: v.Width})
+	}
+
+	return append(variants, markdown.ImageVariant{Url: uploaded.Url, Width: uploaded.Width})
+}
+
+// localImageVariants writes variants of jpeg or png image at relative url `dest` next to
+// the image's copy in the out directory, named `<name>-<width>w-<hash>.<ext>`. Hash of the
+// image and its encoding settings changes with them, so existing variants are reused
+func (app *App) localImageVariants(dest string, r relocation) ([]markdown.ImageVariant, error) {
+	u, err := neturl.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.RawQuery != "" || u.Fragment != "" || u.Path == "" || path.IsAbs(u.Path) {
+		return nil, nil
+	}
+
+	content, err := app.src.ReadFile(r.srcPath(u.Path))
+	if err != nil {
+		app.log.Debug(fmt.Sprintf("localImageVariants: skipping %v: %v", dest, err))
+		return nil, nil
+	}
+
+	width, ok := images.Width(content)
+	if !ok {
+		return nil, nil
+	}
+
+	widths := images.Widths(width, app.config.Images.Widths)
+	if len(widths) == 0 {
+		return nil, nil
+	}
+
+	dir, name := path.Split(u.Path)
+	ext := path.Ext(name)
+	outDirPath := filepath.Join(r.htmlDirPath, filepath.FromSlash(dir))
+
+	if rel, err := filepath.Rel(app.outDirPath, outDirPath); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("image is outside of the out directory")
+	}
+
+	h := sha256.New()
+	h.Write(content)
+	fmt.Fprintf(h, "%+v", app.config.Cdn.Images)
+	hash := h.Sum(nil)
+
+	variantName := func(w int) string {
+		return fmt.Sprintf("%v-%vw-%x%v", strings.TrimSuffix(name, ext), w, hash[:4], ext)
+	}
+
+	missing := make([]int, 0, len(widths))
+	for _, w := range widths {
+		if _, err := os.Stat(filepath.Join(outDirPath, variantName(w))); err != nil {
+			missing = append(missing, w)
+		}
+	}
+
+	if len(missing) > 0 {
+		resized, err := images.Variants(content, missing, app.config.Cdn.Images)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.MkdirAll(outDirPath, os.ModePerm); err != nil {
+			return nil, err
+		}
+
+		for _, v := range resized {
+			if err := utils.WriteFileAtomic(filepath.Join(outDirPath, variantName(v.Width)), v.Content); err != nil {
+				return nil, err
+			}
+		}
+
+		app.log.Debug(fmt.Sprintf("localImageVariants: written %v variants of %v", len(resized), dest))
+	}
+
+	variants := make([]markdown.ImageVariant, 0, len(widths)+1)
+	for _, w := range widths {
+		variants = append(variants, markdown.ImageVariant{Url: dir + variantName(w), Width: w})
+	}
+
+	return append(variants, markdown.ImageVariant{Url: u.Path, Width: width}), nil
+}
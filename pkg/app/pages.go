@@ -0,0 +1,136 @@
+package app
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/templates"
+	"github.com/mtratsiuk/b3/pkg/utils"
+)
+
+// Pages are standalone markdown documents (e.g. "about") rendered to the root
+// of the out directory. Pages are not listed on the home page and don't have timestamps
+type Pages = map[PostId]*Post
+
+const PAGES_URL_PREFIX = "."
+
+func (app *App) loadPages() (Pages, error) {
+	pages := make(Pages, 0)
+
+	sources, err := app.matchPostSources(app.config.PagesGlob)
+	if err != nil {
+		return pages, fmt.Errorf("loadPages: %v", err)
+	}
+
+	for _, src := range sources {
+		app.log.Debug(fmt.Sprintf("loadPages: processing page match: %v", src.FilePath))
+
+		if dup, ok := pages[src.Id]; ok {
+			return pages, fmt.Errorf("loadPages: duplicate page id '%v' for %v and %v", src.Id, dup.FilePath, src.FilePath)
+		}
+
+		page := Post{}
+		page.Id = src.Id
+		page.FilePath = src.FilePath
+		page.BundleDirPath = src.BundleDirPath
+
+		if err := app.loadPost(&page, PAGES_URL_PREFIX); err != nil {
+			return pages, fmt.Errorf("loadPages: failed to load page %v: %v", page.FilePath, err)
+		}
+
+		pages[page.Id] = &page
+	}
+
+	return pages, nil
+}
+
+// resolveHeaderLinks replaces `page` references of header links with the pages' urls
+func (app *App) resolveHeaderLinks(pages Pages) error {
+	links := make([]config.ConfigHeaderLink, 0, len(app.config.HeaderLinks))
+
+	for _, l := range app.config.HeaderLinks {
+		if l.Page != "" {
+			page, ok := pages[PostId(l.Page)]
+			if !ok {
+				return fmt.Errorf("resolveHeaderLinks: header link '%v' references unknown page '%v'", l.Name, l.Page)
+			}
+
+			l.Url = app.absoluteUrl(page.HtmlFilePath)
+		}
+
+		links = append(links, l)
+	}
+
+	app.config.HeaderLinks = links
+	app.templates = app.templates.WithConfig(app.config)
+
+	return nil
+}
+
+// checkPagePaths rejects pages rendered to the same files as the home page,
+// collection listing pages or posts, which would overwrite each other
+func (app *App) checkPagePaths(pages Pages, posts Posts) error {
+	generated := map[string]string{filepath.Join(app.outDirPath, "index.html"): "home page"}
+
+	for _, coll := range app.config.Collections {
+		if coll.Listing {
+			generated[app.collectionListingFilePath(coll)] = fmt.Sprintf("listing page of collection '%v'", coll.Name)
+		}
+	}
+
+	for _, post := range posts {
+		generated[post.HtmlFilePath] = fmt.Sprintf("post %v", post.FilePath)
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(pages)) {
+		page := pages[id]
+		if used, ok := generated[page.HtmlFilePath]; ok {
+			return fmt.Errorf("checkPagePaths: page '%v' (%v) can't be rendered to %v used by %v", id, page.FilePath, page.HtmlFilePath, used)
+		}
+	}
+
+	return nil
+}
+
+func (app *App) renderPages(pages Pages) error {
+	for _, page := range pages {
+		if err := app.renderPage(page); err != nil {
+			return fmt.Errorf("renderPages: failed to render page %v: %v", page.Id, err)
+		}
+		app.log.Debug(fmt.Sprintf("renderPages: rendered page: %v", page.HtmlFilePath))
+	}
+
+	return nil
+}
+
+func (app *App) renderPage(page *Post) error {
+	data := templates.PageData{
+		Title:       string(page.Title),
+		Description: utils.TrimText(utils.StripHtml(string(page.Description)), app.config.TrimPostOgDescriptionsAt),
+		PageHtml:    page.Html,
+	}
+
+	pageOutDirPath := filepath.Dir(page.HtmlFilePath)
+
+	if err := os.MkdirAll(pageOutDirPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	if page.BundleDirPath != "" {
+		if err := app.copyBundleAssets(page.BundleDirPath, pageOutDirPath); err != nil {
+			return fmt.Errorf("failed to copy bundle assets: %v", err)
+		}
+	}
+
+	out, err := os.Create(page.HtmlFilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return app.templates.RenderPage(out, data)
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+func TestCheckPagePaths(t *testing.T) {
+	out := filepath.FromSlash("/blog/out")
+	app := &App{
+		outDirPath: out,
+		config: config.Config{Collections: []config.ConfigCollection{
+			{Name: "posts", Listing: true},
+			{Name: "notes", UrlPrefix: "."},
+		}},
+	}
+
+	posts := Posts{
+		"a": {Id: "a", FilePath: "posts/a.md", HtmlFilePath: filepath.Join(out, "posts", "a.html")},
+		"b": {Id: "b", FilePath: "notes/b.md", HtmlFilePath: filepath.Join(out, "b.html")},
+	}
+
+	tests := []struct {
+		page string // page's html path relative to the out directory
+		err  string
+	}{
+		{"about.html", ""},
+		{"index/index.html", ""},
+		{"index.html", "used by home page"},
+		{"posts/index.html", "used by listing page of collection 'posts'"},
+		{"notes/index.html", ""}, // listing of `notes` is not rendered
+		{"b.html", "used by post notes/b.md"},
+	}
+
+	for idx, test := range tests {
+		pages := Pages{"page": {Id: "page", FilePath: "pages/page.md", HtmlFilePath: filepath.Join(out, filepath.FromSlash(test.page))}}
+
+		err := app.checkPagePaths(pages, posts)
+		if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%v) checkPagePaths(%v): expected error '%v' but got %v", idx, test.page, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mtratsiuk/b3/pkg/markdown"
+)
+
+// relocation maps relative destinations of markdown file located in `srcDirPath` to html file
+// located in `htmlDirPath`. Out directory mirrors the blog's root, so destinations are rewritten
+// when html file is placed elsewhere, e.g. with collection's `url_prefix` or for pages, which
+// are rendered to the root of the out directory. Files of a bundle are copied next to its html file
+type relocation struct {
+	app         *App
+	uploadRe    *regexp.Regexp
+	srcDirPath  string
+	htmlDirPath string
+	bundle      bool
+}
+
+func (app *App) newRelocation(srcDirPath, htmlDirPath, bundleDirPath string) relocation {
+	r := relocation{
+		app:         app,
+		srcDirPath:  srcDirPath,
+		htmlDirPath: htmlDirPath,
+		bundle:      bundleDirPath != "",
+	}
+
+	if app.config.AssetsToUploadRegexp != "" {
+		r.uploadRe = regexp.MustCompile(app.config.AssetsToUploadRegexp)
+	}
+
+	return r
+}
+
+// rewrite replaces relative destinations in markdown source, leaving the rest of the source intact.
+// Assets meant to be uploaded to CDN are resolved relative to the source by `cdnUrls`
+func (r relocation) rewrite(source []byte) []byte {
+	return markdown.Rewrite(source, markdown.Refs(source), func(ref markdown.Ref) (string, bool) {
+		if r.uploadRe != nil && r.uploadRe.MatchString(ref.Dest) {
+			return "", false
+		}
+
+		return r.dest(ref.Dest)
+	})
+}
+
+// dest returns destination relative to the html file pointing to the same file
+// as relative destination `dest` of the markdown file
+func (r relocation) dest(dest string) (string, bool) {
+	destPath, suffix := dest, ""
+	if idx := strings.IndexAny(dest, "?#"); idx >= 0 {
+		destPath, suffix = dest[:idx], dest[idx:]
+	}
+
+	if destPath == "" || path.IsAbs(destPath) || strings.Contains(destPath, ":") {
+		return "", false
+	}
+
+	outPath := r.outPath(filepath.Join(r.srcDirPath, filepath.FromSlash(destPath)))
+
+	rel, err := filepath.Rel(r.htmlDirPath, outPath)
+	if err != nil {
+		return "", false
+	}
+
+	relocated := filepath.ToSlash(rel)
+	if strings.HasSuffix(destPath, "/") {
+		relocated += "/"
+	}
+
+	if relocated == path.Clean(destPath) || relocated == destPath {
+		return "", false
+	}
+
+	return relocated + suffix, true
+}
+
+// outPath returns path of the source file's copy in the out directory
+func (r relocation) outPath(srcPath string) string {
+	if r.bundle {
+		if rel, err := filepath.Rel(r.srcDirPath, srcPath); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(r.htmlDirPath, rel)
+		}
+	}
+
+	return filepath.Join(r.app.outDirPath, r.app.relativeToRoot(srcPath))
+}
+
+// srcPath returns path of the source file referenced by relocated destination `dest`
+// relative to the html file
+func (r relocation) srcPath(dest string) string {
+	outPath := filepath.Join(r.htmlDirPath, filepath.FromSlash(dest))
+
+	if r.bundle {
+		if rel, err := filepath.Rel(r.htmlDirPath, outPath); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(r.srcDirPath, rel)
+		}
+	}
+
+	rel, err := filepath.Rel(r.app.outDirPath, outPath)
+	if err != nil {
+		return outPath
+	}
+
+	return r.app.ResolveRelativePath(rel)
+}
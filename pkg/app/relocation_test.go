@@ -0,0 +1,69 @@
+package app
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+func TestRelocation(t *testing.T) {
+	root := filepath.FromSlash("/blog")
+	app := &App{
+		params:     Params{RootPath: root},
+		config:     config.Config{AssetsToUploadRegexp: `^\.\./cdn/`},
+		outDirPath: filepath.Join(root, "out"),
+	}
+
+	tests := []struct {
+		srcDir   string
+		htmlDir  string
+		bundle   bool
+		dest     string
+		expected string
+	}{
+		// Html file is placed to the mirror of the source directory
+		{"posts", "out/posts", false, "../assets/rock.png", "../assets/rock.png"},
+		// Collection's `url_prefix` is deeper than the source directory
+		{"posts", "out/blog/2024", false, "../assets/rock.png", "../../assets/rock.png"},
+		{"posts", "out/blog/2024", false, "../assets/rock.png#top", "../../assets/rock.png#top"},
+		{"posts", "out/blog/2024", false, "other.html?q=1", "../../posts/other.html?q=1"},
+		{"posts", "out/blog/2024", false, "../assets/", "../../assets/"},
+		// Pages are rendered to the root of the out directory
+		{"pages", "out", false, "../assets/rock.png", "assets/rock.png"},
+		{"pages", "out", false, "../posts/a.html", "posts/a.html"},
+		// Files of a bundle are copied next to its html file
+		{"posts/bundle", "out/blog/bundle", true, "./cheese.svg", "./cheese.svg"},
+		{"posts/bundle", "out/blog/2024/bundle", true, "../../assets/rock.png", "../../../assets/rock.png"},
+		// Urls, anchors and assets uploaded to CDN are kept
+		{"posts", "out/blog/2024", false, "https://example.com/a.png", "https://example.com/a.png"},
+		{"posts", "out/blog/2024", false, "mailto:a@example.com", "mailto:a@example.com"},
+		{"posts", "out/blog/2024", false, "/assets/rock.png", "/assets/rock.png"},
+		{"posts", "out/blog/2024", false, "#heading", "#heading"},
+		{"posts", "out/blog/2024", false, "../cdn/a.png", "../cdn/a.png"},
+	}
+
+	for idx, test := range tests {
+		srcDir := filepath.Join(root, filepath.FromSlash(test.srcDir))
+		bundleDir := ""
+		if test.bundle {
+			bundleDir = srcDir
+		}
+
+		r := app.newRelocation(srcDir, filepath.Join(root, filepath.FromSlash(test.htmlDir)), bundleDir)
+
+		source := "![a](" + test.dest + ")"
+		if got := string(r.rewrite([]byte(source))); got != "![a]("+test.expected+")" {
+			t.Errorf("%v) rewrite(%v): expected '%v' but got '%v'", idx, test.dest, test.expected, got)
+		}
+
+		// Sources of relocated local files are found by their new destinations
+		if test.dest[0] == '.' && !strings.ContainsAny(test.dest, "?#") && test.dest != "../cdn/a.png" {
+			expected := filepath.Join(srcDir, filepath.FromSlash(test.dest))
+			if got := r.srcPath(test.expected); got != expected {
+				t.Errorf("%v) srcPath(%v): expected '%v' but got '%v'", idx, test.expected, expected, got)
+			}
+		}
+	}
+}
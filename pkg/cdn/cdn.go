@@ -1,72 +1,416 @@
 package cdn
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/images"
 )
 
+// Storage is a backend storing uploaded assets
+type Storage interface {
+	Put(ctx context.Context, obj Object) error
+	Exists(ctx context.Context, key string) (bool, error)
+	// List returns objects with keys starting with `prefix`
+	List(ctx context.Context, prefix string) ([]StoredObject, error)
+	Delete(ctx context.Context, key string) error
+	// Url returns public url of the object
+	Url(key string) string
+}
+
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+type Object struct {
+	Key                string
+	Body               []byte
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	Metadata           map[string]string
+}
+
+const (
+	BACKEND_S3    = "s3"
+	BACKEND_LOCAL = "local"
+)
+
+// Cdn uploads assets to the storage under content-addressed keys
 type Cdn struct {
-	client *s3.Client
-}
-
-func New() (Cdn, error) {
-	cdn := Cdn{}
-
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				os.Getenv("B3_S3_ACCESS_KEY_ID"),
-				os.Getenv("B3_S3_ACCESS_KEY_SECRET"),
-				"",
-			),
-		),
-		config.WithRegion("auto"),
-	)
+	storage      Storage
+	rootPath     string // header rules are matched against asset paths relative to it
+	keyPrefix    string
+	manifest     *Manifest
+	verifyRemote bool
+	headers      []headersRule
+	images       config.ConfigCdnImages
+	widths       []int // of image variants
+	timeout      time.Duration
+	retries      int
+}
+
+const (
+	UPLOADED = "uploaded"
+	// Asset would be uploaded, reported in dry-run
+	PLANNED = "to upload"
+	// Asset is recorded in the manifest
+	SKIPPED_MANIFEST = "skipped (manifest)"
+	// Asset is not recorded in the manifest, but exists in the storage
+	SKIPPED_EXISTS = "skipped (exists)"
+)
+
+type Upload struct {
+	Key    string
+	Url    string
+	Status string
+}
+
+// New creates cdn with the storage backend selected in config. Settings missing
+// in config are read from `B3_S3_*` environment variables, e.g. to keep secrets out of `b3.json`.
+// Assets are located in the blog's `rootPath`, and images are uploaded together with their variants of `widths`
+func New(cfg config.ConfigCdn, rootPath string, widths []int) (Cdn, error) {
+	manifest, err := LoadManifest(cfg.ManifestPath)
 	if err != nil {
-		return Cdn{}, fmt.Errorf("cdn.New: failed to load config")
+		return Cdn{}, fmt.Errorf("cdn.New: failed to load manifest: %v", err)
 	}
 
-	cdn.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(os.Getenv("B3_S3_ENDPOINT"))
-	})
+	headers, err := newHeadersRules(cfg.Headers)
+	if err != nil {
+		return Cdn{}, fmt.Errorf("cdn.New: invalid headers pattern: %v", err)
+	}
+
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		return Cdn{}, fmt.Errorf("cdn.New: invalid timeout: %v", err)
+	}
+
+	cdn := Cdn{
+		rootPath:     rootPath,
+		keyPrefix:    cfg.KeyPrefix,
+		manifest:     manifest,
+		verifyRemote: cfg.VerifyRemote,
+		headers:      headers,
+		images:       cfg.Images,
+		widths:       widths,
+		timeout:      timeout,
+		retries:      cfg.Retries,
+	}
+	if cdn.keyPrefix == "" {
+		cdn.keyPrefix = os.Getenv("B3_S3_FILE_PREFIX")
+	}
+
+	switch cfg.Backend {
+	case BACKEND_S3:
+		s3, err := NewS3(cfg.S3)
+		if err != nil {
+			return Cdn{}, fmt.Errorf("cdn.New: %v", err)
+		}
+		cdn.storage = s3
+	case BACKEND_LOCAL:
+		local, err := NewLocal(cfg.Local)
+		if err != nil {
+			return Cdn{}, fmt.Errorf("cdn.New: %v", err)
+		}
+		cdn.storage = local
+	default:
+		return Cdn{}, fmt.Errorf("cdn.New: unexpected backend: %v", cfg.Backend)
+	}
 
 	return cdn, nil
 }
 
-func (cdn Cdn) UploadAsset(path string) (string, error) {
-	asset, err := os.ReadFile(path)
+// UploadAsset uploads asset at `path` unless it's recorded in the manifest, or
+// already exists in the storage when remote verification is enabled. Images are
+// uploaded together with their variants. Requests are retried on transient
+// failures, and cancelled once `ctx` is done
+func (cdn Cdn) UploadAsset(ctx context.Context, path string) (Upload, error) {
+	source, asset, assetSha256, err := cdn.readAsset(path)
+	if err != nil {
+		return Upload{}, fmt.Errorf("UploadAsset: %v", err)
+	}
+
+	assetKey := cdn.assetKey(path, assetSha256)
+	widths := cdn.variantWidths(source)
+
+	// Images recorded without variants are uploaded again, e.g. after `images.widths` are changed
+	if recorded, ok := cdn.manifest.Find(path, assetSha256); ok && recorded.Key == assetKey && recorded.hasVariants(widths) {
+		exists := true
+		if cdn.verifyRemote {
+			if exists, err = cdn.exists(ctx, assetKey); err != nil {
+				return Upload{}, fmt.Errorf("UploadAsset: failed to check asset %v: %v", path, err)
+			}
+		}
+
+		if exists {
+			return Upload{assetKey, recorded.Url, SKIPPED_MANIFEST}, nil
+		}
+	}
+
+	if asset == nil {
+		if asset, err = cdn.optimize(path, source); err != nil {
+			return Upload{}, fmt.Errorf("UploadAsset: %v", err)
+		}
+	}
+
+	upload := Upload{assetKey, cdn.storage.Url(assetKey), UPLOADED}
+
+	uploaded, err := cdn.put(ctx, path, assetKey, asset)
+	if err != nil {
+		return Upload{}, fmt.Errorf("UploadAsset: %v", err)
+	}
+	if !uploaded {
+		upload.Status = SKIPPED_EXISTS
+	}
+
+	recorded := ManifestAsset{
+		Sha256:     assetSha256,
+		Key:        assetKey,
+		Url:        upload.Url,
+		UploadedAt: time.Now().UTC(),
+		Size:       len(asset),
+		Images:     images.Settings(cdn.images),
+	}
+	if sourceSha256 := AssetSha256(source); sourceSha256 != assetSha256 {
+		recorded.SourceSha256 = sourceSha256
+	}
+
+	if len(widths) > 0 {
+		recorded.Width, _ = images.Width(asset)
+
+		if recorded.Variants, err = cdn.uploadVariants(ctx, path, source, widths); err != nil {
+			return Upload{}, fmt.Errorf("UploadAsset: %v", err)
+		}
+	}
+
+	if err := cdn.manifest.Add(path, recorded); err != nil {
+		return Upload{}, fmt.Errorf("UploadAsset: failed to update manifest: %v", err)
+	}
+
+	return upload, nil
+}
+
+// uploadVariants uploads variants of image at `path` downscaled from its `source` content
+func (cdn Cdn) uploadVariants(ctx context.Context, path string, source []byte, widths []int) ([]ManifestVariant, error) {
+	variants, err := images.Variants(source, widths, cdn.images)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make variants of image %v: %v", path, err)
+	}
+
+	recorded := make([]ManifestVariant, 0, len(variants))
+
+	for _, v := range variants {
+		key := cdn.assetKey(path, AssetSha256(v.Content))
+
+		if _, err := cdn.put(ctx, path, key, v.Content); err != nil {
+			return nil, fmt.Errorf("variant %vw: %v", v.Width, err)
+		}
+
+		recorded = append(recorded, ManifestVariant{v.Width, key, cdn.storage.Url(key)})
+	}
+
+	return recorded, nil
+}
+
+// put uploads `content` of asset at `path` under `key`, unless it already exists in
+// the storage when remote verification is enabled. Returns false if upload is skipped
+func (cdn Cdn) put(ctx context.Context, path string, key string, content []byte) (bool, error) {
+	if cdn.verifyRemote {
+		exists, err := cdn.exists(ctx, key)
+		if err != nil {
+			return false, fmt.Errorf("failed to check asset %v: %v", path, err)
+		}
+
+		if exists {
+			return false, nil
+		}
+	}
+
+	obj := withHeaders(Object{
+		Key:         key,
+		Body:        content,
+		ContentType: ContentType(path, content),
+	}, cdn.relativePath(path), cdn.headers)
+
+	err := cdn.retry(ctx, func(ctx context.Context) error {
+		return cdn.storage.Put(ctx, obj)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to upload asset %v: %v", path, err)
+	}
+
+	return true, nil
+}
+
+// relativePath returns path of the asset relative to the blog's root
+func (cdn Cdn) relativePath(path string) string {
+	rel, err := filepath.Rel(cdn.rootPath, path)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
+
+// Plan describes upload of an asset without making it
+type Plan struct {
+	Upload
+	Sha256      string
+	Size        int
+	ContentType string
+}
+
+// PlanAsset returns key and url which asset at `path` would be uploaded to, without
+// making any requests. Status is SKIPPED_MANIFEST if the asset is recorded in the manifest
+func (cdn Cdn) PlanAsset(path string) (Plan, error) {
+	source, asset, assetSha256, err := cdn.readAsset(path)
 	if err != nil {
-		return "", fmt.Errorf("UploadAsset: failed to open asset file at %v: %v", path, err)
+		return Plan{}, fmt.Errorf("PlanAsset: %v", err)
+	}
+
+	assetKey := cdn.assetKey(path, assetSha256)
+
+	plan := Plan{
+		Upload:      Upload{assetKey, cdn.storage.Url(assetKey), PLANNED},
+		Sha256:      assetSha256,
+		Size:        len(asset),
+		ContentType: withHeaders(Object{ContentType: ContentType(path, source)}, cdn.relativePath(path), cdn.headers).ContentType,
 	}
 
-	h := sha256.New()
-	h.Write(asset)
+	recorded, ok := cdn.manifest.Find(path, assetSha256)
+	if asset == nil {
+		plan.Size = recorded.Size
+	}
+
+	if ok && recorded.Key == assetKey && recorded.hasVariants(cdn.variantWidths(source)) {
+		plan.Url = recorded.Url
+		plan.Status = SKIPPED_MANIFEST
+	}
+
+	return plan, nil
+}
 
-	assetSha256 := base64.StdEncoding.EncodeToString(h.Sum(nil))
-	assetExt := path[strings.LastIndex(path, ".")+1:]
-	assetKey := fmt.Sprintf("%v/%v.%v", os.Getenv("B3_S3_FILE_PREFIX"), assetSha256, assetExt)
+// Objects returns stored objects under the key prefix
+func (cdn Cdn) Objects(ctx context.Context) ([]StoredObject, error) {
+	var objects []StoredObject
 
-	_, err = cdn.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(os.Getenv("B3_S3_BUCKET_NAME")),
-		Key:         aws.String(assetKey),
-		Body:        bytes.NewReader(asset),
-		ContentType: aws.String(fmt.Sprintf("image/%v", assetExt)),
+	err := cdn.retry(ctx, func(ctx context.Context) error {
+		var err error
+		objects, err = cdn.storage.List(ctx, cdn.keyPrefix+"/")
+		return err
 	})
+	if err != nil {
+		return nil, fmt.Errorf("Objects: failed to list objects: %v", err)
+	}
+
+	return objects, nil
+}
 
+// Delete deletes stored object and removes it from the manifest
+func (cdn Cdn) Delete(ctx context.Context, key string) error {
+	err := cdn.retry(ctx, func(ctx context.Context) error {
+		return cdn.storage.Delete(ctx, key)
+	})
 	if err != nil {
-		return "", fmt.Errorf("UploadAsset: failed to upload asset %v: %v", path, err)
+		return fmt.Errorf("Delete: failed to delete %v: %v", key, err)
+	}
+
+	if err := cdn.manifest.RemoveKey(key); err != nil {
+		return fmt.Errorf("Delete: failed to update manifest: %v", err)
 	}
 
-	return fmt.Sprintf("%v/%v", os.Getenv("B3_S3_BUCKET_PUBLIC_HOST"), assetKey), nil
+	return nil
+}
+
+// Key returns key of the object served at public `url`. Leading slash of
+// the key may be lost, e.g. if the key prefix is empty
+func (cdn Cdn) Key(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, cdn.storage.Url(""))
+	return key, ok && key != ""
+}
+
+// readAsset returns content of the asset file, content to upload optimized if it's an image, and
+// sha256 of the content to upload. Asset file recorded in the manifest as optimized with the same
+// settings is not optimized again, and nil content to upload is returned for it
+func (cdn Cdn) readAsset(path string) ([]byte, []byte, string, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to open asset file at %v: %v", path, err)
+	}
+
+	if settings := images.Settings(cdn.images); settings != "" {
+		if recorded, ok := cdn.manifest.FindSource(path, AssetSha256(source), settings); ok {
+			return source, nil, recorded.Sha256, nil
+		}
+	}
+
+	asset, err := cdn.optimize(path, source)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return source, asset, AssetSha256(asset), nil
+}
+
+func (cdn Cdn) optimize(path string, source []byte) ([]byte, error) {
+	optimized, err := images.Optimize(source, cdn.images)
+	if err != nil {
+		return nil, fmt.Errorf("failed to optimize image %v: %v", path, err)
+	}
+
+	return optimized, nil
+}
+
+// variantWidths returns widths of variants uploaded with the asset read from `source`, if it's a resizable image
+func (cdn Cdn) variantWidths(source []byte) []int {
+	if len(cdn.widths) == 0 {
+		return nil
+	}
+
+	width, ok := images.Width(source)
+	if !ok {
+		return nil
+	}
+
+	// Images wider than max width are uploaded downscaled to it
+	if cdn.images.MaxWidth > 0 {
+		width = min(width, cdn.images.MaxWidth)
+	}
+
+	return images.Widths(width, cdn.widths)
+}
+
+// VariantKeys returns keys of variants of the image uploaded under `key`
+func (cdn Cdn) VariantKeys(key string) []string {
+	return cdn.manifest.VariantKeys(key)
+}
+
+func (cdn Cdn) assetKey(path string, assetSha256 string) string {
+	return fmt.Sprintf("%v/%v%v", cdn.keyPrefix, assetSha256, filepath.Ext(path))
+}
+
+func (cdn Cdn) exists(ctx context.Context, key string) (bool, error) {
+	exists := false
+	err := cdn.retry(ctx, func(ctx context.Context) error {
+		var err error
+		exists, err = cdn.storage.Exists(ctx, key)
+		return err
+	})
+
+	return exists, err
+}
+
+// AssetSha256 returns base64 encoded sha256 of the asset, used in the asset's key
+func AssetSha256(asset []byte) string {
+	h := sha256.Sum256(asset)
+	return base64.StdEncoding.EncodeToString(h[:])
 }
@@ -0,0 +1,156 @@
+package cdn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+func TestUploadAsset(t *testing.T) {
+	// 112px wide image of the example blog
+	content, err := os.ReadFile(filepath.Join("..", "..", "example", "assets", "rock.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimized := config.ConfigCdnImages{MaxWidth: 30, JpegQuality: 85}
+
+	// Asset is uploaded with variants of width 10, then again with settings of the test
+	tests := []struct {
+		name         string
+		remove       string // `object` or `manifest` removed between the uploads
+		verifyRemote bool
+		widths       []int
+		images       config.ConfigCdnImages
+		status       string
+		variants     []int // widths of variants recorded in the manifest
+	}{
+		{"manifest hit", "", false, []int{10}, config.ConfigCdnImages{}, SKIPPED_MANIFEST, []int{10}},
+		{"manifest hit verified", "", true, []int{10}, config.ConfigCdnImages{}, SKIPPED_MANIFEST, []int{10}},
+		{"object removed", "object", false, []int{10}, config.ConfigCdnImages{}, SKIPPED_MANIFEST, []int{10}},
+		{"object removed verified", "object", true, []int{10}, config.ConfigCdnImages{}, UPLOADED, []int{10}},
+		{"manifest removed", "manifest", false, []int{10}, config.ConfigCdnImages{}, UPLOADED, []int{10}},
+		{"manifest removed verified", "manifest", true, []int{10}, config.ConfigCdnImages{}, SKIPPED_EXISTS, []int{10}},
+		{"variant widths changed", "", false, []int{10, 30}, config.ConfigCdnImages{}, UPLOADED, []int{10, 30}},
+		{"variant not narrower than asset", "", false, []int{10, 112}, config.ConfigCdnImages{}, SKIPPED_MANIFEST, []int{10}},
+		{"optimization changed", "", false, []int{10, 30}, optimized, UPLOADED, []int{10}},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.png")
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := config.ConfigCdn{
+			Backend:      BACKEND_LOCAL,
+			KeyPrefix:    "assets",
+			ManifestPath: filepath.Join(dir, "manifest.json"),
+			Timeout:      "1s",
+			Local:        config.ConfigCdnLocal{DirPath: filepath.Join(dir, "bucket"), PublicUrl: "https://cdn.example.com"},
+		}
+
+		first := uploadTestAsset(t, cfg, []int{10}, path)
+
+		switch test.remove {
+		case "object":
+			if err := os.Remove(filepath.Join(cfg.Local.DirPath, first.Key)); err != nil {
+				t.Fatal(err)
+			}
+		case "manifest":
+			if err := os.Remove(cfg.ManifestPath); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cfg.VerifyRemote = test.verifyRemote
+		cfg.Images = test.images
+		second := uploadTestAsset(t, cfg, test.widths, path)
+
+		if second.Status != test.status {
+			t.Errorf("%v: expected status %q but got %q", test.name, test.status, second.Status)
+		}
+
+		m, err := LoadManifest(cfg.ManifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorded, ok := m.Assets["a.png"]
+
+		widths := make([]int, 0)
+		for _, v := range recorded.Variants {
+			widths = append(widths, v.Width)
+		}
+
+		if !ok || !slices.Equal(widths, test.variants) {
+			t.Errorf("%v: expected asset recorded with variants %v but got %v, %v", test.name, test.variants, widths, ok)
+		}
+
+		// Objects removed from the storage are noticed only with remote verification
+		if test.remove == "object" && !test.verifyRemote {
+			continue
+		}
+
+		if exists, _ := (LocalStorage{dirPath: cfg.Local.DirPath}).Exists(context.Background(), second.Key); !exists {
+			t.Errorf("%v: expected asset to be stored under %v", test.name, second.Key)
+		}
+	}
+}
+
+func TestAssetHeaders(t *testing.T) {
+	tests := []struct {
+		path     string // relative to the blog's root
+		expected string // content type
+	}{
+		{"cdn/downloads/a.bin", "application/x-download"},
+		{"posts/cdn/downloads/a.bin", "application/octet-stream"},
+		{"cdn/a.bin", "application/octet-stream"},
+	}
+
+	for idx, test := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, filepath.FromSlash(test.path))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte{0, 1, 2}, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Anchored patterns match regardless of where the blog is located
+		cdn, err := New(config.ConfigCdn{
+			Backend:      BACKEND_LOCAL,
+			ManifestPath: filepath.Join(dir, "manifest.json"),
+			Timeout:      "1s",
+			Local:        config.ConfigCdnLocal{DirPath: filepath.Join(dir, "bucket"), PublicUrl: "https://cdn.example.com"},
+			Headers:      []config.ConfigCdnHeaders{{Pattern: "^cdn/downloads/", ContentType: "application/x-download"}},
+		}, dir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plan, err := cdn.PlanAsset(path)
+		if err != nil || plan.ContentType != test.expected {
+			t.Errorf("%v) PlanAsset(%v): expected content type %v but got %v, %v", idx, test.path, test.expected, plan.ContentType, err)
+		}
+	}
+}
+
+func uploadTestAsset(t *testing.T, cfg config.ConfigCdn, widths []int, path string) Upload {
+	cdn, err := New(cfg, filepath.Dir(cfg.ManifestPath), widths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload, err := cdn.UploadAsset(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return upload
+}
@@ -0,0 +1,103 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+// LocalStorage stores assets in a local directory, e.g. one served by a self-hosted
+// web server, or a temporary one to try `-mode cdn` offline. Headers of objects
+// are not stored, they are up to the web server
+type LocalStorage struct {
+	dirPath   string
+	publicUrl string
+}
+
+func NewLocal(cfg config.ConfigCdnLocal) (LocalStorage, error) {
+	if cfg.DirPath == "" {
+		return LocalStorage{}, fmt.Errorf("NewLocal: `dir_path` is not defined")
+	}
+
+	return LocalStorage{cfg.DirPath, strings.TrimSuffix(cfg.PublicUrl, "/")}, nil
+}
+
+func (s LocalStorage) Put(ctx context.Context, obj Object) error {
+	path := s.path(obj.Key)
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, obj.Body, 0644)
+}
+
+func (s LocalStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s LocalStorage) List(ctx context.Context, prefix string) ([]StoredObject, error) {
+	objects := make([]StoredObject, 0)
+
+	err := filepath.WalkDir(s.dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.dirPath, path)
+		if err != nil {
+			return err
+		}
+
+		// Keys are stored without the leading slash
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, strings.TrimPrefix(prefix, "/")) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(prefix, "/") {
+			key = "/" + key
+		}
+
+		objects = append(objects, StoredObject{key, info.Size(), info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return objects, nil
+	}
+
+	return objects, err
+}
+
+func (s LocalStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s LocalStorage) Url(key string) string {
+	return fmt.Sprintf("%v/%v", s.publicUrl, strings.TrimPrefix(key, "/"))
+}
+
+func (s LocalStorage) path(key string) string {
+	return filepath.Join(s.dirPath, filepath.FromSlash(strings.TrimPrefix(key, "/")))
+}
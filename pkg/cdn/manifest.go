@@ -0,0 +1,211 @@
+package cdn
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_MANIFEST_FILE_NAME = "b3-cdn-manifest.json"
+
+// Manifest records uploaded assets, so that unchanged assets are not uploaded again.
+// It's meant to be committed together with the posts referencing the assets
+type Manifest struct {
+	mu     sync.Mutex
+	path   string
+	Assets map[string]ManifestAsset `json:"assets"` // by asset path relative to the manifest's directory
+}
+
+type ManifestAsset struct {
+	Sha256       string            `json:"sha256"`                  // of the uploaded content
+	SourceSha256 string            `json:"source_sha256,omitempty"` // of the asset file, if it differs from the uploaded optimized image
+	Key          string            `json:"key"`
+	Url          string            `json:"url"`
+	UploadedAt   time.Time         `json:"uploaded_at"`
+	Size         int               `json:"size,omitempty"`     // of the uploaded content
+	Images       string            `json:"images,omitempty"`   // settings of image optimization applied to the asset file
+	Width        int               `json:"width,omitempty"`    // displayed width of image uploaded with variants
+	Variants     []ManifestVariant `json:"variants,omitempty"` // downscaled variants of image, by ascending width
+}
+
+type ManifestVariant struct {
+	Width int    `json:"width"`
+	Key   string `json:"key"`
+	Url   string `json:"url"`
+}
+
+// LoadManifest reads manifest at `path`, or returns empty manifest if it doesn't exist yet
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ParseManifest(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseManifest(path, data)
+}
+
+// ParseManifest parses manifest located at `path`, empty `data` is parsed as empty manifest
+func ParseManifest(path string, data []byte) (*Manifest, error) {
+	m := &Manifest{path: path, Assets: make(map[string]ManifestAsset)}
+
+	if len(data) == 0 {
+		return m, nil
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+
+	if m.Assets == nil {
+		m.Assets = make(map[string]ManifestAsset)
+	}
+
+	return m, nil
+}
+
+// Find returns uploaded asset with the same content, or uploaded optimized from the same
+// content of asset file, preferring the one uploaded from `assetPath`
+func (m *Manifest) Find(assetPath string, sha256 string) (ManifestAsset, bool) {
+	return m.find(assetPath, func(a ManifestAsset) bool {
+		return a.matches(sha256)
+	})
+}
+
+// FindSource returns asset uploaded from the same content of asset file optimized with
+// the same `images` settings, preferring the one uploaded from `assetPath`
+func (m *Manifest) FindSource(assetPath string, sourceSha256 string, images string) (ManifestAsset, bool) {
+	return m.find(assetPath, func(a ManifestAsset) bool {
+		if a.Images != images {
+			return false
+		}
+
+		// Source hash is recorded only if optimized content differs from the asset file
+		return a.SourceSha256 == sourceSha256 || (a.SourceSha256 == "" && a.Sha256 == sourceSha256)
+	})
+}
+
+func (m *Manifest) find(assetPath string, match func(a ManifestAsset) bool) (ManifestAsset, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.Assets[m.rel(assetPath)]; ok && match(a) {
+		return a, true
+	}
+
+	// Keys are content-addressed, so the same content uploaded from another path can be reused
+	for _, a := range m.Assets {
+		if match(a) {
+			return a, true
+		}
+	}
+
+	return ManifestAsset{}, false
+}
+
+// FindUrl returns uploaded asset with public `url`
+func (m *Manifest) FindUrl(url string) (ManifestAsset, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, a := range m.Assets {
+		if a.Url == url {
+			return a, true
+		}
+	}
+
+	return ManifestAsset{}, false
+}
+
+// VariantKeys returns keys of variants of images uploaded under `key`
+func (m *Manifest) VariantKeys(key string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0)
+	for _, a := range m.Assets {
+		// Leading slash is lost in urls of keys without prefix
+		if strings.TrimPrefix(a.Key, "/") != strings.TrimPrefix(key, "/") {
+			continue
+		}
+
+		for _, v := range a.Variants {
+			if !slices.Contains(keys, v.Key) {
+				keys = append(keys, v.Key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// Add records uploaded asset and writes the manifest
+func (m *Manifest) Add(assetPath string, asset ManifestAsset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Assets[m.rel(assetPath)] = asset
+
+	return m.write()
+}
+
+// RemoveKey removes assets uploaded under `key` and writes the manifest
+func (m *Manifest) RemoveKey(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := false
+	for path, a := range m.Assets {
+		if a.Key == key {
+			delete(m.Assets, path)
+			removed = true
+		}
+	}
+
+	if !removed {
+		return nil
+	}
+
+	return m.write()
+}
+
+func (m *Manifest) write() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.path)
+}
+
+func (a ManifestAsset) matches(sha256 string) bool {
+	return a.Sha256 == sha256 || a.SourceSha256 == sha256
+}
+
+// hasVariants reports whether image is uploaded with variants of `widths`
+func (a ManifestAsset) hasVariants(widths []int) bool {
+	return slices.EqualFunc(a.Variants, widths, func(v ManifestVariant, w int) bool {
+		return v.Width == w
+	})
+}
+
+func (m *Manifest) rel(assetPath string) string {
+	rel, err := filepath.Rel(filepath.Dir(m.path), assetPath)
+	if err != nil {
+		return filepath.ToSlash(assetPath)
+	}
+
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,63 @@
+package cdn
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assets := map[string]ManifestAsset{
+		"a.png":        {Sha256: "A", Key: "p/A.png", Url: "a"},
+		"nested/c.png": {Sha256: "A", Key: "p/A.png", Url: "c"},
+		"b.jpg":        {Sha256: "B", SourceSha256: "S", Key: "p/B.jpg", Url: "b"},
+	}
+	for assetPath, a := range assets {
+		if err := m.Add(filepath.Join(dir, assetPath), a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Added assets are written to the manifest
+	if m, err = LoadManifest(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		sha256 string
+		url    string // empty if asset is not found
+	}{
+		{"a.png", "A", "a"},
+		{"nested/c.png", "A", "c"},
+		{"other.png", "B", "b"},
+		{"b.jpg", "S", "b"},
+		{"a.png", "B", "b"},
+		{"a.png", "C", ""},
+	}
+
+	for idx, test := range tests {
+		a, ok := m.Find(filepath.Join(dir, test.path), test.sha256)
+		if ok != (test.url != "") || a.Url != test.url {
+			t.Errorf("%v) Find(%v, %v): expected %q but got %q, %v", idx, test.path, test.sha256, test.url, a.Url, ok)
+		}
+	}
+
+	if err := m.RemoveKey("p/A.png"); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = LoadManifest(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.Find(filepath.Join(dir, "a.png"), "A"); ok || len(m.Assets) != 1 {
+		t.Errorf("RemoveKey: expected assets uploaded under the key to be removed, got %v", m.Assets)
+	}
+}
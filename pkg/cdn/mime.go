@@ -0,0 +1,108 @@
+package cdn
+
+import (
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+// Types of common assets, which don't depend on system mime database
+var contentTypes = map[string]string{
+	".apng": "image/apng",
+	".avif": "image/avif",
+	".gif":  "image/gif",
+	".ico":  "image/x-icon",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".ogv":  "video/ogg",
+	".webm": "video/webm",
+
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+
+	".pdf":  "application/pdf",
+	".7z":   "application/x-7z-compressed",
+	".gz":   "application/gzip",
+	".tar":  "application/x-tar",
+	".tgz":  "application/gzip",
+	".zip":  "application/zip",
+	".json": "application/json",
+	".txt":  "text/plain; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".vtt":  "text/vtt; charset=utf-8",
+}
+
+// ContentType returns mime type of the asset by its extension, or detected
+// from the content if the extension is unknown
+func ContentType(path string, content []byte) string {
+	if t, ok := contentTypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return t
+	}
+
+	return http.DetectContentType(content)
+}
+
+type headersRule struct {
+	re      *regexp.Regexp
+	headers config.ConfigCdnHeaders
+}
+
+func newHeadersRules(headers []config.ConfigCdnHeaders) ([]headersRule, error) {
+	rules := make([]headersRule, 0, len(headers))
+
+	for _, h := range headers {
+		re, err := regexp.Compile(h.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, headersRule{re, h})
+	}
+
+	return rules, nil
+}
+
+// withHeaders sets headers of the rules matching the asset path relative to the blog's root
+func withHeaders(obj Object, path string, rules []headersRule) Object {
+	path = filepath.ToSlash(path)
+
+	for _, r := range rules {
+		if !r.re.MatchString(path) {
+			continue
+		}
+
+		if r.headers.ContentType != "" {
+			obj.ContentType = r.headers.ContentType
+		}
+		if r.headers.CacheControl != "" {
+			obj.CacheControl = r.headers.CacheControl
+		}
+		if r.headers.ContentDisposition != "" {
+			obj.ContentDisposition = r.headers.ContentDisposition
+		}
+
+		for k, v := range r.headers.Metadata {
+			if obj.Metadata == nil {
+				obj.Metadata = make(map[string]string)
+			}
+			obj.Metadata[k] = v
+		}
+	}
+
+	return obj
+}
@@ -0,0 +1,55 @@
+package cdn
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		path     string
+		content  string
+		expected string
+	}{
+		{"a.svg", "<svg></svg>", "image/svg+xml"},
+		{"a.JPG", "", "image/jpeg"},
+		{"a.mp4", "", "video/mp4"},
+		{"a.pdf", "", "application/pdf"},
+		{"a.zip", "", "application/zip"},
+		{"a", "%PDF-1.4", "application/pdf"},
+		{"a.unknown", "\x89PNG\r\n\x1a\n", "image/png"},
+		{"a.unknown", "\x00\x01", "application/octet-stream"},
+	}
+
+	for idx, test := range tests {
+		if result := ContentType(test.path, []byte(test.content)); result != test.expected {
+			t.Errorf("%v) ContentType(%q): expected %v but got %v", idx, test.path, test.expected, result)
+		}
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	rules, err := newHeadersRules([]config.ConfigCdnHeaders{
+		{Pattern: ".*", CacheControl: "public, max-age=31536000, immutable", Metadata: map[string]string{"blog": "b3"}},
+		{Pattern: `\.zip$`, ContentDisposition: "attachment", Metadata: map[string]string{"kind": "archive"}},
+		{Pattern: `^drafts/`, CacheControl: "no-cache"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := withHeaders(Object{Key: "key", ContentType: "application/zip"}, "cdn/a.zip", rules)
+	expected := Object{
+		Key:                "key",
+		ContentType:        "application/zip",
+		CacheControl:       "public, max-age=31536000, immutable",
+		ContentDisposition: "attachment",
+		Metadata:           map[string]string{"blog": "b3", "kind": "archive"},
+	}
+
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("withHeaders: expected %+v but got %+v", expected, obj)
+	}
+}
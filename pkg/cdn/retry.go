@@ -0,0 +1,51 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+const RETRY_BASE_DELAY = 500 * time.Millisecond
+
+// retry runs storage request `f` with the request timeout, retrying transient
+// failures with exponential backoff until the retries are exhausted or `ctx` is done
+func (cdn Cdn) retry(ctx context.Context, f func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		reqCtx, cancel := context.WithTimeout(ctx, cdn.timeout)
+		err := f(reqCtx)
+		cancel()
+
+		if err == nil || ctx.Err() != nil || attempt >= cdn.retries || !transient(err) {
+			return err
+		}
+
+		// Jitter spreads retries of parallel uploads failed at the same time
+		delay := RETRY_BASE_DELAY<<attempt + rand.N(RETRY_BASE_DELAY)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// transient reports whether the failed request may succeed if retried
+func transient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var httpErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &httpErr) {
+		status := httpErr.HTTPStatusCode()
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
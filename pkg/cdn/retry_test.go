@@ -0,0 +1,37 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	permanent := errors.New("access denied")
+
+	tests := []struct {
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{[]error{nil}, 1, nil},
+		{[]error{context.DeadlineExceeded, nil}, 2, nil},
+		{[]error{permanent, nil}, 1, permanent},
+		{[]error{context.DeadlineExceeded, context.DeadlineExceeded, nil}, 2, context.DeadlineExceeded},
+	}
+
+	cdn := Cdn{timeout: time.Second, retries: 1}
+
+	for idx, test := range tests {
+		attempts := 0
+		err := cdn.retry(context.Background(), func(ctx context.Context) error {
+			attempts += 1
+			return test.errs[attempts-1]
+		})
+
+		if attempts != test.attempts || !errors.Is(err, test.err) {
+			t.Errorf("%v) retry: expected %v attempts and error %v but got %v attempts and error %v", idx, test.attempts, test.err, attempts, err)
+		}
+	}
+}
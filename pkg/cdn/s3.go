@@ -0,0 +1,155 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+// S3Storage stores assets in S3-compatible object storage, e.g. Cloudflare R2
+type S3Storage struct {
+	client     *s3.Client
+	bucket     string
+	publicHost string
+}
+
+func NewS3(cfg config.ConfigCdnS3) (S3Storage, error) {
+	s := S3Storage{
+		bucket:     orEnv(cfg.Bucket, "B3_S3_BUCKET_NAME"),
+		publicHost: orEnv(cfg.PublicHost, "B3_S3_BUCKET_PUBLIC_HOST"),
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(
+		context.TODO(),
+		awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(
+				orEnv(cfg.AccessKeyId, "B3_S3_ACCESS_KEY_ID"),
+				orEnv(cfg.AccessKeySecret, "B3_S3_ACCESS_KEY_SECRET"),
+				"",
+			),
+		),
+		awsconfig.WithRegion(orEnv(cfg.Region, "B3_S3_REGION", "auto")),
+	)
+	if err != nil {
+		return S3Storage{}, fmt.Errorf("NewS3: failed to load config: %v", err)
+	}
+
+	endpoint := orEnv(cfg.Endpoint, "B3_S3_ENDPOINT")
+
+	s.client = s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		// Requests are retried by Cdn with its own timeouts
+		o.RetryMaxAttempts = 1
+	})
+
+	return s, nil
+}
+
+func (s S3Storage) Put(ctx context.Context, obj Object) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(obj.Key),
+		Body:        bytes.NewReader(obj.Body),
+		ContentType: aws.String(obj.ContentType),
+		Metadata:    obj.Metadata,
+	}
+
+	if obj.CacheControl != "" {
+		input.CacheControl = aws.String(obj.CacheControl)
+	}
+	if obj.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(obj.ContentDisposition)
+	}
+
+	_, err := s.client.PutObject(ctx, input)
+
+	return err
+}
+
+func (s S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	var notFound *types.NotFound
+	var httpErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &notFound) || (errors.As(err, &httpErr) && httpErr.HTTPStatusCode() == http.StatusNotFound) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (s S3Storage) List(ctx context.Context, prefix string) ([]StoredObject, error) {
+	objects := make([]StoredObject, 0)
+
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			objects = append(objects, StoredObject{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (s S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
+func (s S3Storage) Url(key string) string {
+	return fmt.Sprintf("%v/%v", s.publicHost, key)
+}
+
+// orEnv returns `value` if it's set, or the first non-empty of environment variable `key` and `fallback`
+func orEnv(value string, key string, fallback ...string) string {
+	if value != "" {
+		return value
+	}
+
+	if env := os.Getenv(key); env != "" {
+		return env
+	}
+
+	for _, f := range fallback {
+		if f != "" {
+			return f
+		}
+	}
+
+	return ""
+}
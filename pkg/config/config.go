@@ -3,14 +3,20 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/mtratsiuk/b3/pkg/utils"
 )
 
 const CONFIG_FILE_NAME = "b3.json"
 
 type Config struct {
 	PostsGlob                []string           `json:"posts_glob"`
+	PagesGlob                []string           `json:"pages_glob"`
+	HomeIntroPath            string             `json:"home_intro_path"` // markdown file rendered above the posts on the home page
 	AssetsToUploadRegexp     string             `json:"assets_to_upload_regexp"`
 	OutDirPath               string             `json:"out_dir_path"`
 	AssetsDirPath            []string           `json:"assets_dir_path"`
@@ -21,15 +27,155 @@ type Config struct {
 	DocDescription           string             `json:"doc_description"`
 	StripHtmlExtInProdLinks  bool               `json:"strip_html_ext_in_prod_links"`
 	TrimPostOgDescriptionsAt int                `json:"trim_post_og_descriptions_at"` // -1 to not trim
+	RelatedPosts             ConfigRelatedPosts `json:"related_posts"`
+	Collections              []ConfigCollection `json:"collections"` // defaults to single "posts" collection matching `posts_glob`
+	Timestamper              []string           `json:"timestamper"` // timestamp sources tried in order: `front_matter`, `git`, `fs`
+	Git                      ConfigGit          `json:"git"`
+	PostHistory              bool               `json:"post_history"` // render page with revisions of each post, requires `git` timestamper
+	Authors                  []ConfigAuthor     `json:"authors"`      // post authors are taken from front matter `author`, or from the first commit
+	Images                   ConfigImages       `json:"images"`
+	Cdn                      ConfigCdn          `json:"cdn"`
 }
 
 type ConfigHeaderLink struct {
 	Name string `json:"name"`
 	Url  string `json:"url"`
+	Page string `json:"page"` // id of the page matched by `pages_glob`, resolved to the page's url
+}
+
+type ConfigAuthor struct {
+	Id     string   `json:"id"` // used in author page url and matched against front matter `author`
+	Name   string   `json:"name"`
+	Emails []string `json:"emails"` // commit author emails
+	Avatar string   `json:"avatar"` // image url
+	Url    string   `json:"url"`
+}
+
+// ConfigImages configures responsive images. Variants of jpeg and png images referenced by posts
+// and pages are generated while building, or uploaded together with the images in `-mode cdn`,
+// and listed in `srcset` of the images. Variants are encoded with `cdn.images` settings
+type ConfigImages struct {
+	Widths []int  `json:"widths"` // widths of variants in pixels, only the ones smaller than the image are generated
+	Sizes  string `json:"sizes"`  // `sizes` attribute of the images
+}
+
+// ConfigCdn selects storage of assets uploaded with `-mode cdn`. Empty settings are read
+// from `B3_S3_*` environment variables, so that secrets can be kept out of `b3.json`
+type ConfigCdn struct {
+	Backend         string             `json:"backend"`          // `s3` (default) or `local`
+	KeyPrefix       string             `json:"key_prefix"`       // B3_S3_FILE_PREFIX
+	ManifestPath    string             `json:"manifest_path"`    // uploaded assets are recorded in the manifest and skipped on the next runs
+	BackupDirPath   string             `json:"backup_dir_path"`  // originals of posts rewritten by the last run, restored with `-mode cdn-rollback`
+	VerifyRemote    bool               `json:"verify_remote"`    // check that assets exist in storage before skipping or uploading them
+	UrlSubstitution string             `json:"url_substitution"` // `source` (default) - replace asset paths in markdown on upload, `build` - use urls from the manifest while building
+	Headers         []ConfigCdnHeaders `json:"headers"`          // applied in order to assets matching the pattern, later rules override earlier ones
+	Concurrency     int                `json:"concurrency"`      // number of parallel uploads
+	Timeout         string             `json:"timeout"`          // timeout of a single storage request, e.g. `30s`
+	Retries         int                `json:"retries"`          // retries of a request after transient failures, with exponential backoff
+	CommitMessage   string             `json:"commit_message"`   // commit rewritten posts and the manifest with this message, add it to `git.ignore_commits.messages` to keep post timestamps
+	Images          ConfigCdnImages    `json:"images"`
+	Gc              ConfigCdnGc        `json:"gc"`
+	S3              ConfigCdnS3        `json:"s3"`
+	Local           ConfigCdnLocal     `json:"local"`
+}
+
+// ConfigCdnImages configures optimization of jpeg and png images before upload. Keys are
+// computed from the optimized content, so changing these settings uploads images again
+type ConfigCdnImages struct {
+	StripMetadata bool `json:"strip_metadata"` // remove exif (including gps), xmp, iptc and text metadata, keeping orientation and color profile
+	MaxWidth      int  `json:"max_width"`      // downscale wider images, 0 to keep the original size
+	Reencode      bool `json:"reencode"`       // re-encode images with `jpeg_quality` and best png compression
+	JpegQuality   int  `json:"jpeg_quality"`   // 1-100
+}
+
+// ConfigCdnGc configures `-mode cdn-gc`, which deletes objects under the key prefix not referenced by posts
+type ConfigCdnGc struct {
+	GracePeriod  string `json:"grace_period"`  // objects uploaded more recently are kept, e.g. referenced by unmerged branches
+	AllRevisions bool   `json:"all_revisions"` // keep objects referenced by any committed revision of posts
+	PlanPath     string `json:"plan_path"`     // objects to delete, written by `-mode cdn-gc -dry` and required to delete them
+}
+
+type ConfigCdnHeaders struct {
+	Pattern            string            `json:"pattern"` // regexp matched against asset path relative to the blog's root, e.g. `^cdn/downloads/`
+	ContentType        string            `json:"content_type"`
+	CacheControl       string            `json:"cache_control"`
+	ContentDisposition string            `json:"content_disposition"` // e.g. `attachment` to download archives instead of opening them
+	Metadata           map[string]string `json:"metadata"`
+}
+
+type ConfigCdnS3 struct {
+	Endpoint        string `json:"endpoint"`          // B3_S3_ENDPOINT
+	Region          string `json:"region"`            // B3_S3_REGION, defaults to `auto`
+	Bucket          string `json:"bucket"`            // B3_S3_BUCKET_NAME
+	PublicHost      string `json:"public_host"`       // B3_S3_BUCKET_PUBLIC_HOST
+	AccessKeyId     string `json:"access_key_id"`     // B3_S3_ACCESS_KEY_ID
+	AccessKeySecret string `json:"access_key_secret"` // B3_S3_ACCESS_KEY_SECRET
+}
+
+type ConfigCdnLocal struct {
+	DirPath   string `json:"dir_path"`   // relative to the blog's root
+	PublicUrl string `json:"public_url"` // url the directory is served at
+}
+
+type ConfigRelatedPosts struct {
+	Count         int     `json:"count"` // 0 to disable
+	TagsWeight    float64 `json:"tags_weight"`
+	ContentWeight float64 `json:"content_weight"`
+	MinScore      float64 `json:"min_score"`
+}
+
+type ConfigGit struct {
+	UncommittedTimestamp string              `json:"uncommitted_timestamp"` // `mtime` or `now`, used for uncommitted and modified posts
+	ShallowClone         string              `json:"shallow_clone"`         // `fail`, `deepen` (fetch full history) or `ignore`
+	IgnoreCommits        ConfigIgnoreCommits `json:"ignore_commits"`        // commits not updating post's `updated` timestamp
+}
+
+type ConfigIgnoreCommits struct {
+	Messages        []string `json:"messages"` // substrings of commit messages, e.g. `[typo]` or `cdn:`
+	Authors         []string `json:"authors"`  // author names or emails
+	MinChangedLines int      `json:"min_changed_lines"`
+}
+
+const (
+	CDN_URLS_SOURCE = "source"
+	CDN_URLS_BUILD  = "build"
+)
+
+const DEFAULT_COLLECTION_NAME = "posts"
+
+const (
+	SORT_CREATED_DESC = "created_desc"
+	SORT_CREATED_ASC  = "created_asc"
+	SORT_UPDATED_DESC = "updated_desc"
+	SORT_ID_ASC       = "id_asc"
+	SORT_ID_DESC      = "id_desc"
+)
+
+type ConfigCollection struct {
+	Name            string   `json:"name"`
+	Title           string   `json:"title"`
+	Glob            []string `json:"glob"`
+	UrlPrefix       string   `json:"url_prefix"` // defaults to post's directory path relative to the blog's root
+	Listing         bool     `json:"listing"`    // render `<url_prefix or name>/index.html` page listing collection's posts
+	Sort            string   `json:"sort"`       // one of `created_desc` (default), `created_asc`, `updated_desc`, `id_asc`, `id_desc`
+	ExcludeFromHome bool     `json:"exclude_from_home"`
+	ExcludeFromFeed bool     `json:"exclude_from_feed"`
+}
+
+// PostsGlobs returns glob patterns of all collections
+func (cfg Config) PostsGlobs() []string {
+	globs := make([]string, 0)
+
+	for _, c := range cfg.Collections {
+		globs = append(globs, c.Glob...)
+	}
+
+	return globs
 }
 
-func New(rootPath string) (Config, error) {
-	data, err := os.ReadFile(filepath.Join(rootPath, CONFIG_FILE_NAME))
+// New reads config of the blog at `rootPath` from `src`
+func New(src utils.Fs, rootPath string) (Config, error) {
+	data, err := src.ReadFile(filepath.Join(rootPath, CONFIG_FILE_NAME))
 
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to read b3 configuration file: %v", err)
@@ -37,6 +183,36 @@ func New(rootPath string) (Config, error) {
 
 	cfg := Config{
 		TrimPostOgDescriptionsAt: -1,
+		Timestamper:              []string{"front_matter", "git", "fs"},
+		RelatedPosts: ConfigRelatedPosts{
+			Count:         3,
+			TagsWeight:    1,
+			ContentWeight: 1,
+			MinScore:      0.05,
+		},
+		Git: ConfigGit{
+			UncommittedTimestamp: "mtime",
+			ShallowClone:         "fail",
+		},
+		Images: ConfigImages{
+			Sizes: "(max-width: 1024px) 100vw, 1024px",
+		},
+		Cdn: ConfigCdn{
+			Backend:         "s3",
+			ManifestPath:    "./b3-cdn-manifest.json",
+			BackupDirPath:   "./.b3-cdn-backup",
+			UrlSubstitution: CDN_URLS_SOURCE,
+			Concurrency:     4,
+			Timeout:         "1m",
+			Retries:         3,
+			Images: ConfigCdnImages{
+				JpegQuality: 85,
+			},
+			Gc: ConfigCdnGc{
+				GracePeriod: "720h",
+				PlanPath:    "./.b3-cdn-gc-plan.json",
+			},
+		},
 	}
 	err = json.Unmarshal(data, &cfg)
 
@@ -44,5 +220,93 @@ func New(rootPath string) (Config, error) {
 		return Config{}, fmt.Errorf("failed to parse b3 configuration file: %v", err)
 	}
 
+	if len(cfg.Collections) == 0 {
+		cfg.Collections = []ConfigCollection{{Name: DEFAULT_COLLECTION_NAME, Glob: cfg.PostsGlob}}
+	} else if len(cfg.PostsGlob) != 0 {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: `posts_glob` can't be used together with `collections`, use collection's `glob` instead")
+	}
+
+	for _, l := range cfg.HeaderLinks {
+		if (l.Url == "") == (l.Page == "") {
+			return Config{}, fmt.Errorf("invalid b3 configuration file: header link '%v' must have either `url` or `page`", l.Name)
+		}
+	}
+
+	if cfg.PostHistory && !slices.Contains(cfg.Timestamper, "git") {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: `post_history` requires `git` timestamper")
+	}
+
+	if cfg.Cdn.UrlSubstitution != CDN_URLS_SOURCE && cfg.Cdn.UrlSubstitution != CDN_URLS_BUILD {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: unexpected cdn url substitution '%v'", cfg.Cdn.UrlSubstitution)
+	}
+
+	if cfg.Cdn.Concurrency < 1 {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: cdn concurrency must be positive, got %v", cfg.Cdn.Concurrency)
+	}
+
+	if timeout, err := time.ParseDuration(cfg.Cdn.Timeout); err != nil || timeout <= 0 {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: invalid cdn timeout '%v'", cfg.Cdn.Timeout)
+	}
+
+	for _, w := range cfg.Images.Widths {
+		if w < 1 {
+			return Config{}, fmt.Errorf("invalid b3 configuration file: images widths must be positive, got %v", w)
+		}
+	}
+
+	if cfg.Cdn.Images.MaxWidth < 0 {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: cdn images max width can't be negative, got %v", cfg.Cdn.Images.MaxWidth)
+	}
+
+	if cfg.Cdn.Images.JpegQuality < 1 || cfg.Cdn.Images.JpegQuality > 100 {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: cdn images jpeg quality must be in 1-100, got %v", cfg.Cdn.Images.JpegQuality)
+	}
+
+	if grace, err := time.ParseDuration(cfg.Cdn.Gc.GracePeriod); err != nil || grace < 0 {
+		return Config{}, fmt.Errorf("invalid b3 configuration file: invalid cdn gc grace period '%v'", cfg.Cdn.Gc.GracePeriod)
+	}
+
+	for _, h := range cfg.Cdn.Headers {
+		if _, err := regexp.Compile(h.Pattern); err != nil {
+			return Config{}, fmt.Errorf("invalid b3 configuration file: invalid cdn headers pattern '%v': %v", h.Pattern, err)
+		}
+	}
+
+	authors := make(map[string]bool)
+	for idx := range cfg.Authors {
+		a := &cfg.Authors[idx]
+
+		if a.Id == "" || authors[a.Id] {
+			return Config{}, fmt.Errorf("invalid b3 configuration file: authors must have unique non-empty ids, got '%v'", a.Id)
+		}
+		authors[a.Id] = true
+
+		if a.Name == "" {
+			a.Name = a.Id
+		}
+	}
+
+	names := make(map[string]bool)
+	for idx := range cfg.Collections {
+		c := &cfg.Collections[idx]
+
+		if c.Name == "" || names[c.Name] {
+			return Config{}, fmt.Errorf("invalid b3 configuration file: collections must have unique non-empty names, got '%v'", c.Name)
+		}
+		names[c.Name] = true
+
+		if c.Title == "" {
+			c.Title = c.Name
+		}
+
+		switch c.Sort {
+		case "":
+			c.Sort = SORT_CREATED_DESC
+		case SORT_CREATED_DESC, SORT_CREATED_ASC, SORT_UPDATED_DESC, SORT_ID_ASC, SORT_ID_DESC:
+		default:
+			return Config{}, fmt.Errorf("invalid b3 configuration file: unexpected sort order '%v' of collection '%v'", c.Sort, c.Name)
+		}
+	}
+
 	return cfg, nil
 }
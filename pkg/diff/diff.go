@@ -0,0 +1,220 @@
+package diff
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type Op byte
+
+const (
+	EQUAL  Op = '='
+	INSERT Op = '+'
+	DELETE Op = '-'
+)
+
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Diff returns the shortest edit script transforming `a` into `b` using linear space
+// variation of Myers' algorithm, which recursively splits the inputs at the middle snake
+// of the edit path. Consecutive edits of the same kind are not merged, and deletions
+// precede insertions within each changed run
+func Diff(a, b []string) []Edit {
+	max := len(a) + len(b)
+	d := differ{
+		a:     a,
+		b:     b,
+		vf:    make([]int, 2*max+3),
+		vb:    make([]int, 2*max+3),
+		edits: make([]Edit, 0, max),
+	}
+
+	d.compare(0, len(a), 0, len(b))
+
+	for start := 0; start < len(d.edits); {
+		end := start
+		for end < len(d.edits) && d.edits[end].Op != EQUAL {
+			end += 1
+		}
+
+		slices.SortStableFunc(d.edits[start:end], func(x, y Edit) int {
+			return cmp.Compare(opOrder(x.Op), opOrder(y.Op))
+		})
+
+		start = end + 1
+	}
+
+	return d.edits
+}
+
+func opOrder(op Op) int {
+	if op == INSERT {
+		return 1
+	}
+
+	return 0
+}
+
+type differ struct {
+	a, b   []string
+	vf, vb []int // furthest reaching x on each diagonal, forward and backward
+	edits  []Edit
+}
+
+// compare appends edit script transforming `a[aLo:aHi]` into `b[bLo:bHi]`
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, Edit{EQUAL, d.a[aLo]})
+		aLo += 1
+		bLo += 1
+	}
+
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix += 1
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	switch {
+	case aLo == aHi:
+		for _, s := range d.b[bLo:bHi] {
+			d.edits = append(d.edits, Edit{INSERT, s})
+		}
+	case bLo == bHi:
+		for _, s := range d.a[aLo:aHi] {
+			d.edits = append(d.edits, Edit{DELETE, s})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+
+		d.compare(aLo, x, bLo, y)
+		for _, s := range d.a[x:u] {
+			d.edits = append(d.edits, Edit{EQUAL, s})
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for _, s := range d.a[aHi : aHi+suffix] {
+		d.edits = append(d.edits, Edit{EQUAL, s})
+	}
+}
+
+// middleSnake returns start `(x, y)` and end `(u, v)` of the snake in the middle of
+// the shortest edit path, found by running the forward and the backward searches
+// until they overlap. Both ranges are non-empty, and differ at their first and last elements
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	offset := (n+m+1)/2 + 1
+
+	d.vf[offset+1] = 0
+	d.vb[offset+1] = 0
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && d.vf[offset+k-1] < d.vf[offset+k+1]) {
+				x = d.vf[offset+k+1]
+			} else {
+				x = d.vf[offset+k-1] + 1
+			}
+
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x += 1
+				y += 1
+			}
+
+			d.vf[offset+k] = x
+
+			// Backward search is on diagonal `delta - k` in reversed coordinates
+			if odd && delta-k >= -(D-1) && delta-k <= D-1 && x+d.vb[offset+delta-k] >= n {
+				return aLo + x0, bLo + y0, aLo + x, bLo + y
+			}
+		}
+
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && d.vb[offset+k-1] < d.vb[offset+k+1]) {
+				x = d.vb[offset+k+1]
+			} else {
+				x = d.vb[offset+k-1] + 1
+			}
+
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x += 1
+				y += 1
+			}
+
+			d.vb[offset+k] = x
+
+			if !odd && delta-k >= -D && delta-k <= D && x+d.vf[offset+delta-k] >= n {
+				return aHi - x, bHi - y, aHi - x0, bHi - y0
+			}
+		}
+	}
+
+	// Unreachable, the searches always overlap
+	return aLo, bLo, aLo, bLo
+}
+
+// Lines splits text into lines, keeping line endings
+func Lines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Words splits text into words and whitespace runs, so that joining the result
+// gives the original text
+func Words(text string) []string {
+	words := make([]string, 0)
+	start := 0
+	prevSpace := false
+
+	for idx, r := range text {
+		space := unicode.IsSpace(r)
+
+		if idx > 0 && space != prevSpace {
+			words = append(words, text[start:idx])
+			start = idx
+		}
+
+		prevSpace = space
+	}
+
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+
+	return words
+}
+
+// Stat returns number of inserted and deleted elements
+func Stat(edits []Edit) (int, int) {
+	inserted, deleted := 0, 0
+
+	for _, e := range edits {
+		switch e.Op {
+		case INSERT:
+			inserted += 1
+		case DELETE:
+			deleted += 1
+		}
+	}
+
+	return inserted, deleted
+}
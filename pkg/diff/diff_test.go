@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected []Edit
+	}{
+		{"", "", []Edit{}},
+		{"a b", "a b", []Edit{{EQUAL, "a"}, {EQUAL, " "}, {EQUAL, "b"}}},
+		{"", "a", []Edit{{INSERT, "a"}}},
+		{"a", "", []Edit{{DELETE, "a"}}},
+		{
+			"the quick fox",
+			"the slow fox",
+			[]Edit{{EQUAL, "the"}, {EQUAL, " "}, {DELETE, "quick"}, {INSERT, "slow"}, {EQUAL, " "}, {EQUAL, "fox"}},
+		},
+		{
+			"a b c d",
+			"b c e",
+			[]Edit{{DELETE, "a"}, {DELETE, " "}, {EQUAL, "b"}, {EQUAL, " "}, {EQUAL, "c"}, {EQUAL, " "}, {DELETE, "d"}, {INSERT, "e"}},
+		},
+	}
+
+	for idx, test := range tests {
+		result := Diff(Words(test.a), Words(test.b))
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%v) Diff(%q, %q): expected '%v' but got '%v'", idx, test.a, test.b, test.expected, result)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"", []string{}},
+		{"a", []string{"a"}},
+		{"a\nb\n", []string{"a\n", "b\n"}},
+		{"a\n\nb", []string{"a\n", "\n", "b"}},
+	}
+
+	for idx, test := range tests {
+		result := Lines(test.text)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%v) Lines(%q): expected '%q' but got '%q'", idx, test.text, test.expected, result)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		old, new string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"0\n1\n2\n3\n4\n5\n6\n7\n",
+			"--- old\n+++ new\n@@ -1 +1,2 @@\n+0\n 1\n@@ -7,2 +8 @@\n 7\n-8\n",
+		},
+		{
+			"a\n",
+			"a\nb",
+			"--- old\n+++ new\n@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+
+	for idx, test := range tests {
+		result := Unified("old", "new", test.old, test.new, 1)
+		if result != test.expected {
+			t.Errorf("%v) Unified(%q, %q): expected\n%v\nbut got\n%v", idx, test.old, test.new, test.expected, result)
+		}
+	}
+}
+
+func TestDiffMemory(t *testing.T) {
+	const n = 5000
+
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := range n {
+		a[i] = fmt.Sprintf("a%v", i)
+		b[i] = a[i]
+		if i%2 == 0 {
+			b[i] = fmt.Sprintf("b%v", i)
+		}
+	}
+
+	tests := []struct {
+		a, b    []string
+		changed int
+	}{
+		{a, nil, n},
+		{nil, b, n},
+		{a, b, n},
+	}
+
+	for idx, test := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		edits := Diff(test.a, test.b)
+		runtime.ReadMemStats(&after)
+
+		// Edits and two diagonal arrays, linear in size of the inputs
+		limit := uint64(128 * (len(test.a) + len(test.b)))
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > limit {
+			t.Errorf("%v) Diff: expected at most %v bytes allocated but got %v", idx, limit, allocated)
+		}
+
+		if inserted, deleted := Stat(edits); inserted+deleted != test.changed {
+			t.Errorf("%v) Diff: expected %v changes but got %v", idx, test.changed, inserted+deleted)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unified returns line diff of `old` and `new` texts in unified format with
+// `context` unchanged lines around changes, or empty string if texts are equal
+func Unified(oldName, newName, old, new string, context int) string {
+	edits := Diff(Lines(old), Lines(new))
+
+	// Line numbers of the edits in old and new texts
+	oldLines := make([]int, len(edits)+1)
+	newLines := make([]int, len(edits)+1)
+	for idx, e := range edits {
+		oldLines[idx+1], newLines[idx+1] = oldLines[idx], newLines[idx]
+		if e.Op != INSERT {
+			oldLines[idx+1] += 1
+		}
+		if e.Op != DELETE {
+			newLines[idx+1] += 1
+		}
+	}
+
+	changes := make([]int, 0)
+	for idx, e := range edits {
+		if e.Op != EQUAL {
+			changes = append(changes, idx)
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %v\n+++ %v\n", oldName, newName)
+
+	for first := 0; first < len(changes); {
+		// Changes separated by few unchanged lines share the hunk
+		last := first
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context+1 {
+			last += 1
+		}
+
+		start := max(changes[first]-context, 0)
+		end := min(changes[last]+context+1, len(edits))
+
+		fmt.Fprintf(
+			&b, "@@ -%v +%v @@\n",
+			hunkRange(oldLines[start], oldLines[end]-oldLines[start]),
+			hunkRange(newLines[start], newLines[end]-newLines[start]),
+		)
+
+		for _, e := range edits[start:end] {
+			prefix := " "
+			switch e.Op {
+			case INSERT:
+				prefix = "+"
+			case DELETE:
+				prefix = "-"
+			}
+
+			b.WriteString(prefix + e.Text)
+			if !strings.HasSuffix(e.Text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		first = last + 1
+	}
+
+	return b.String()
+}
+
+// hunkRange formats range of `count` lines after line `start` (zero-based)
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%v,0", start)
+	case 1:
+		return fmt.Sprintf("%v", start+1)
+	default:
+		return fmt.Sprintf("%v,%v", start+1, count)
+	}
+}
@@ -0,0 +1,84 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const ATOM_NS = "http://www.w3.org/2005/Atom"
+const FILE_NAME = "feed.xml"
+
+type Feed struct {
+	XMLName  xml.Name `xml:"feed"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Id       string   `xml:"id"`
+	Title    string   `xml:"title"`
+	Subtitle string   `xml:"subtitle,omitempty"`
+	Updated  string   `xml:"updated"`
+	Links    []Link   `xml:"link"`
+	Authors  []Person `xml:"author,omitempty"`
+	Entries  []Entry  `xml:"entry"`
+}
+
+type Link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type Entry struct {
+	Id        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Links     []Link   `xml:"link"`
+	Authors   []Person `xml:"author,omitempty"`
+	Summary   *Text    `xml:"summary,omitempty"`
+}
+
+type Person struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+	Uri   string `xml:"uri,omitempty"`
+}
+
+type Text struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Write writes atom feed to `wr`. Feed's `updated` time is set to the latest entry's update time
+func Write(wr io.Writer, f Feed) error {
+	f.Xmlns = ATOM_NS
+
+	if f.Updated == "" {
+		latest := time.Time{}
+
+		for _, e := range f.Entries {
+			if t, err := time.Parse(time.RFC3339, e.Updated); err == nil && t.After(latest) {
+				latest = t
+			}
+		}
+
+		f.Updated = FormatTime(latest)
+	}
+
+	if _, err := io.WriteString(wr, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(wr)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(wr, "\n")
+	return err
+}
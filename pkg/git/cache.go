@@ -0,0 +1,100 @@
+package git
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// HISTORY_CACHE_FILE_NAME is formatted with hash of the ref, so that builds from different refs
+// don't overwrite each other's cache
+const HISTORY_CACHE_FILE_NAME = "b3-history-%x.json"
+
+// LoadHistory returns history of the repository reachable from `ref`, or from HEAD if `ref` is empty.
+// History is cached in the repository's git directory per ref and reused until the resolved commit
+// changes or shallow clone is deepened
+func LoadHistory(repo Repo, ref string) (*History, error) {
+	var head string
+	var err error
+
+	if ref == "" {
+		head, err = repo.Head()
+	} else {
+		head, err = repo.ResolveRef(ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git.LoadHistory: failed to resolve %v: %v", cmp.Or(ref, "HEAD"), err)
+	}
+
+	if head == "" {
+		return &History{Commits: []Commit{}}, nil
+	}
+
+	shallow, err := repo.IsShallow()
+	if err != nil {
+		return nil, fmt.Errorf("git.LoadHistory: failed to check if repository is shallow: %v", err)
+	}
+
+	gitDir, err := repo.GitDir()
+	if err != nil {
+		return nil, fmt.Errorf("git.LoadHistory: failed to resolve git directory: %v", err)
+	}
+	cachePath := filepath.Join(gitDir, historyCacheFileName(cmp.Or(ref, "HEAD")))
+
+	if h, err := readHistoryCache(cachePath); err == nil && h.Head == head && h.Shallow == shallow {
+		return h, nil
+	}
+
+	commits, err := repo.Log(head)
+	if err != nil {
+		return nil, fmt.Errorf("git.LoadHistory: failed to read git log: %v", err)
+	}
+
+	h := &History{Head: head, Shallow: shallow, Commits: commits}
+
+	// Failing to write cache only makes the next build slower
+	_ = writeHistoryCache(cachePath, h)
+
+	return h, nil
+}
+
+func historyCacheFileName(ref string) string {
+	hash := sha256.Sum256([]byte(ref))
+	return fmt.Sprintf(HISTORY_CACHE_FILE_NAME, hash[:8])
+}
+
+func readHistoryCache(path string) (*History, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := History{}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+
+	if h.Head == "" {
+		return nil, errors.New("invalid history cache")
+	}
+
+	return &h, nil
+}
+
+func writeHistoryCache(path string, h *History) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package git
+
+import (
+	"cmp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadHistoryCachePerRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git executable is not available")
+	}
+
+	dir := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	commit := func(path string) {
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run("add", "-A")
+		run("commit", "-q", "-m", path)
+	}
+
+	run("init", "-q", "-b", "main")
+	run("config", "user.name", "Author")
+	run("config", "user.email", "author@example.com")
+
+	commit("a.md")
+	run("checkout", "-q", "-b", "feature")
+	commit("b.md")
+	run("checkout", "-q", "main")
+
+	repo := NewCli(dir)
+
+	tests := []struct {
+		ref     string
+		commits int
+	}{
+		{"", 1},
+		{"feature", 2},
+		{"main", 1},
+		// Cached history of another ref is not overwritten
+		{"", 1},
+		{"feature", 2},
+	}
+
+	for idx, test := range tests {
+		h, err := LoadHistory(repo, test.ref)
+		if err != nil {
+			t.Fatalf("%v) LoadHistory('%v'): unexpected error: %v", idx, test.ref, err)
+		}
+
+		head, err := repo.ResolveRef(cmp.Or(test.ref, "HEAD"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.Head != head || len(h.Commits) != test.commits {
+			t.Errorf("%v) LoadHistory('%v'): expected %v commits from %v but got %v from %v", idx, test.ref, test.commits, head, len(h.Commits), h.Head)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, ".git", historyCacheFileName(cmp.Or(test.ref, "HEAD")))); err != nil {
+			t.Errorf("%v) LoadHistory('%v'): cache is not written: %v", idx, test.ref, err)
+		}
+	}
+
+	if historyCacheFileName("main") == historyCacheFileName("feature") {
+		t.Errorf("historyCacheFileName: expected different names for different refs")
+	}
+}
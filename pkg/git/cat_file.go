@@ -0,0 +1,147 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// catFile reads objects with a single long-running `git cat-file --batch` process,
+// started on the first read and stopped by `close`. Otherwise the process exits once b3 closes its stdin on exit.
+// With `check` set, the process is started with `--batch-check` and reads only objects' sizes
+type catFile struct {
+	mu     sync.Mutex
+	dir    string
+	check  bool
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// read returns content of the object `hash` of `kind`
+func (cf *catFile) read(hash string, kind string) ([]byte, error) {
+	content, _, err := cf.do(hash, kind)
+	return content, err
+}
+
+// size returns size of the object `hash` of `kind`
+func (cf *catFile) size(hash string, kind string) (int64, error) {
+	_, size, err := cf.do(hash, kind)
+	return size, err
+}
+
+func (cf *catFile) do(hash string, kind string) ([]byte, int64, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if cf.cmd == nil {
+		if err := cf.start(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	content, size, err := cf.request(hash, kind)
+	if err != nil {
+		// Output of the process can't be trusted after a failed read, next read starts a new one
+		cf.stop()
+		return nil, 0, err
+	}
+
+	return content, size, nil
+}
+
+func (cf *catFile) start() error {
+	mode := "--batch"
+	if cf.check {
+		mode = "--batch-check"
+	}
+
+	cmd := exec.Command("git", "cat-file", mode)
+	cmd.Dir = cf.dir
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("git cat-file: %v", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("git cat-file: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git cat-file: %v", err)
+	}
+
+	cf.cmd, cf.stdin, cf.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// close stops the process, the next read starts a new one
+func (cf *catFile) close() {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if cf.cmd != nil {
+		cf.stop()
+	}
+}
+
+func (cf *catFile) stop() {
+	cf.stdin.Close()
+	cf.cmd.Process.Kill()
+	cf.cmd.Wait()
+
+	cf.cmd, cf.stdin, cf.stdout = nil, nil, nil
+}
+
+// request writes object name and reads response `<hash> <type> <size>\n<content>\n`,
+// or `<name> missing\n` if the object doesn't exist. Content is omitted by `--batch-check`
+func (cf *catFile) request(hash string, kind string) ([]byte, int64, error) {
+	if strings.ContainsAny(hash, " \n") {
+		return nil, 0, fmt.Errorf("git cat-file: invalid object name %q", hash)
+	}
+
+	if _, err := io.WriteString(cf.stdin, hash+"\n"); err != nil {
+		return nil, 0, fmt.Errorf("git cat-file: %v", err)
+	}
+
+	header, err := cf.stdout.ReadString('\n')
+	if err != nil {
+		return nil, 0, fmt.Errorf("git cat-file: %v", err)
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) == 2 && fields[1] == "missing" {
+		return nil, 0, fmt.Errorf("git cat-file: %w: %v", ErrObjectNotFound, hash)
+	}
+	if len(fields) != 3 {
+		return nil, 0, fmt.Errorf("git cat-file: unexpected header %q", header)
+	}
+
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, 0, fmt.Errorf("git cat-file: unexpected header %q", header)
+	}
+
+	var content []byte
+
+	if !cf.check {
+		// Content is followed by a newline
+		content = make([]byte, size+1)
+		if _, err := io.ReadFull(cf.stdout, content); err != nil {
+			return nil, 0, fmt.Errorf("git cat-file: %v", err)
+		}
+		content = content[:size]
+	}
+
+	if fields[1] != kind {
+		return nil, 0, fmt.Errorf("git cat-file: object %v is %v, not %v", hash, fields[1], kind)
+	}
+
+	return content, int64(size), nil
+}
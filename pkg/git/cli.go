@@ -0,0 +1,295 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cli reads repository history using `git` executable
+type Cli struct {
+	dir     string
+	status  *cliStatus
+	objects *catFile
+	sizes   *catFile
+}
+
+type cliStatus struct {
+	once     sync.Once
+	modified map[string]bool
+	err      error
+}
+
+func NewCli(dir string) Cli {
+	return Cli{dir, &cliStatus{}, &catFile{dir: dir}, &catFile{dir: dir, check: true}}
+}
+
+func (c Cli) Toplevel() (string, error) {
+	toplevel, err := c.run("rev-parse", "--show-toplevel")
+	if err != nil && strings.Contains(err.Error(), "not a git repository") {
+		return "", fmt.Errorf("%w: %v", ErrNotRepository, c.dir)
+	}
+
+	return toplevel, err
+}
+
+func (c Cli) GitDir() (string, error) {
+	return c.run("rev-parse", "--path-format=absolute", "--git-common-dir")
+}
+
+func (c Cli) Head() (string, error) {
+	if _, err := c.run("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return "", nil
+	}
+
+	return c.run("rev-parse", "HEAD")
+}
+
+func (c Cli) ResolveRef(ref string) (string, error) {
+	return c.run("rev-parse", "--verify", "--end-of-options", ref+"^{commit}")
+}
+
+// Close stops `git cat-file` processes reading objects
+func (c Cli) Close() error {
+	c.objects.close()
+	c.sizes.close()
+	return nil
+}
+
+func (c Cli) ListTree(hash string) ([]TreeFile, error) {
+	out, err := c.run("ls-tree", "-r", "-z", "--full-tree", hash)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]TreeFile, 0)
+
+	// Entries are `<mode> <type> <hash>\t<path>`
+	for _, entry := range strings.Split(out, "\x00") {
+		if entry == "" {
+			continue
+		}
+
+		header, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(header)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("git ls-tree: unexpected entry: %q", entry)
+		}
+
+		if fields[1] != "blob" {
+			continue
+		}
+
+		files = append(files, TreeFile{path, fields[0], fields[2]})
+	}
+
+	return files, nil
+}
+
+const (
+	recordSep = "\x1e"
+	fieldSep  = "\x1f"
+)
+
+// Log reads commits with their changes in a single `git log` invocation. Copies are detected
+// the same way `git log --follow` does, with unmodified files as sources
+func (c Cli) Log(ref string) ([]Commit, error) {
+	out, err := c.run(
+		"log", "-z", "--raw", "--no-abbrev", "-C", "--find-copies-harder",
+		"--format="+recordSep+strings.Join([]string{"%H", "%aI", "%an", "%ae", "%B"}, fieldSep),
+		ref, "--",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLog(out)
+}
+
+func parseLog(out string) ([]Commit, error) {
+	commits := make([]Commit, 0)
+
+	for _, record := range strings.Split(out, recordSep) {
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+
+		header, raw, _ := strings.Cut(record, "\x00")
+		fields := strings.SplitN(header, fieldSep, 5)
+
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("parseLog: unexpected commit header: %q", header)
+		}
+
+		date, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("parseLog: failed to parse commit date: %v", err)
+		}
+
+		changes, err := parseRaw(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parseLog: commit %v: %v", fields[0], err)
+		}
+
+		commits = append(commits, Commit{
+			Hash:        fields[0],
+			AuthorDate:  date,
+			AuthorName:  fields[2],
+			AuthorEmail: fields[3],
+			Message:     strings.TrimSpace(fields[4]),
+			Changes:     changes,
+		})
+	}
+
+	return commits, nil
+}
+
+// parseRaw parses `git log --raw -z` entries: `:<mode> <mode> <blob> <blob> <status>\0<path>\0[<path>\0]`
+func parseRaw(raw string) ([]Change, error) {
+	changes := make([]Change, 0)
+	tokens := strings.Split(strings.TrimLeft(raw, "\n"), "\x00")
+
+	for idx := 0; idx < len(tokens); idx++ {
+		meta := strings.TrimSpace(tokens[idx])
+		if meta == "" {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(meta, ":"))
+		if len(fields) != 5 || idx+1 >= len(tokens) {
+			return nil, fmt.Errorf("unexpected raw diff entry: %q", meta)
+		}
+
+		ch := Change{
+			Status:  fields[4][0],
+			OldBlob: fields[2],
+			NewBlob: fields[3],
+			OldPath: tokens[idx+1],
+			Path:    tokens[idx+1],
+		}
+		idx += 1
+
+		if ch.Status == 'R' || ch.Status == 'C' {
+			if idx+1 >= len(tokens) {
+				return nil, fmt.Errorf("unexpected raw diff entry: %q", meta)
+			}
+			ch.Path = tokens[idx+1]
+			idx += 1
+		}
+
+		changes = append(changes, ch)
+	}
+
+	return changes, nil
+}
+
+func (c Cli) ReadBlob(hash string) ([]byte, error) {
+	if hash == zeroHash {
+		return []byte{}, nil
+	}
+
+	return c.objects.read(hash, "blob")
+}
+
+func (c Cli) BlobSize(hash string) (int64, error) {
+	if hash == zeroHash {
+		return 0, nil
+	}
+
+	return c.sizes.size(hash, "blob")
+}
+
+// Modified reads status of the whole working tree once with `git status`
+func (c Cli) Modified(path string) (bool, error) {
+	c.status.once.Do(func() {
+		c.status.modified, c.status.err = c.readStatus()
+	})
+
+	return c.status.modified[path], c.status.err
+}
+
+func (c Cli) readStatus() (map[string]bool, error) {
+	toplevel, err := c.Toplevel()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	cmd.Dir = toplevel
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status: %v", err)
+	}
+
+	modified := make(map[string]bool)
+	entries := strings.Split(string(out), "\x00")
+
+	// Entries are `XY <path>`, renames and copies are followed by the original path
+	for idx := 0; idx < len(entries); idx++ {
+		entry := entries[idx]
+		if len(entry) < 4 {
+			continue
+		}
+
+		modified[entry[3:]] = true
+
+		if entry[0] == 'R' || entry[0] == 'C' {
+			idx += 1
+		}
+	}
+
+	return modified, nil
+}
+
+func (c Cli) IsShallow() (bool, error) {
+	out, err := c.run("rev-parse", "--is-shallow-repository")
+	return out == "true", err
+}
+
+func (c Cli) Unshallow() error {
+	_, err := c.run("fetch", "--unshallow")
+	return err
+}
+
+// Commit commits current content of the files at `paths`, leaving out other staged changes.
+// Returns false if the files have no changes to commit
+func (c Cli) Commit(message string, paths []string) (bool, error) {
+	if _, err := c.run(append([]string{"add", "--"}, paths...)...); err != nil {
+		return false, err
+	}
+
+	// Exits with 1 if there are staged changes
+	cmd := exec.Command("git", append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...)
+	cmd.Dir = c.dir
+
+	if err := cmd.Run(); err == nil {
+		return false, nil
+	} else if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		return false, fmt.Errorf("git diff: %v", err)
+	}
+
+	if _, err := c.run(append([]string{"commit", "-q", "-m", message, "--"}, paths...)...); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c Cli) run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = c.dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %v: %v: %v", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
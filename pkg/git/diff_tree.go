@@ -0,0 +1,333 @@
+package git
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// Minimal similarity of deleted and added files to be detected as rename,
+// same as `git diff -M` default
+const renameThreshold = 0.5
+
+// Rename detection compares every source file with every added file,
+// skip inexact detection for huge commits like `diff.renameLimit` does
+const renameLimit = 1000
+
+// diffTrees returns changed files between two trees (empty hash for an empty tree),
+// detecting renames and copies similarly to `git diff -C --find-copies-harder`,
+// which `git log --follow` uses to find the file's origin
+func (n *Native) diffTrees(oldTree, newTree string) ([]Change, error) {
+	changes := make([]Change, 0)
+
+	if err := n.diffTreesAt("", oldTree, newTree, &changes); err != nil {
+		return nil, err
+	}
+
+	return n.detectRenames(oldTree, changes)
+}
+func (n *Native) diffTreesAt(prefix, oldTree, newTree string, changes *[]Change) error {
+	if oldTree == newTree {
+		return nil
+	}
+
+	oldEntries, err := n.readTree(oldTree)
+	if err != nil {
+		return err
+	}
+
+	newEntries, err := n.readTree(newTree)
+	if err != nil {
+		return err
+	}
+
+	olds := make(map[string]treeEntry, len(oldEntries))
+	for _, e := range oldEntries {
+		olds[e.name] = e
+	}
+
+	news := make(map[string]treeEntry, len(newEntries))
+	for _, e := range newEntries {
+		news[e.name] = e
+	}
+
+	for _, o := range oldEntries {
+		path := prefix + o.name
+		nw, exists := news[o.name]
+
+		switch {
+		case !exists || o.isDir() != nw.isDir():
+			if err := n.addEntries(path, o, 'D', changes); err != nil {
+				return err
+			}
+			if exists {
+				if err := n.addEntries(path, nw, 'A', changes); err != nil {
+					return err
+				}
+			}
+		case o.isDir():
+			if err := n.diffTreesAt(path+"/", o.hash, nw.hash, changes); err != nil {
+				return err
+			}
+		case o.hash != nw.hash || o.mode != nw.mode:
+			status := byte('M')
+			if isSymlink(o.mode) != isSymlink(nw.mode) {
+				status = 'T'
+			}
+			*changes = append(*changes, Change{Status: status, Path: path, OldPath: path, OldBlob: o.hash, NewBlob: nw.hash})
+		}
+	}
+
+	for _, nw := range newEntries {
+		if _, exists := olds[nw.name]; !exists {
+			if err := n.addEntries(prefix+nw.name, nw, 'A', changes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// addEntries adds change for the file entry, or for every file of the directory entry
+func (n *Native) addEntries(path string, e treeEntry, status byte, changes *[]Change) error {
+	if !e.isDir() {
+		ch := Change{Status: status, Path: path, OldPath: path, OldBlob: zeroHash, NewBlob: zeroHash}
+		if status == 'D' {
+			ch.OldBlob = e.hash
+		} else {
+			ch.NewBlob = e.hash
+		}
+		*changes = append(*changes, ch)
+		return nil
+	}
+
+	entries, err := n.readTree(e.hash)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range entries {
+		if err := n.addEntries(path+"/"+child.name, child, status, changes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const zeroHash = "0000000000000000000000000000000000000000"
+
+func isSymlink(mode string) bool {
+	return mode == "120000"
+}
+
+// detectRenames pairs added files with identical or similar files of the old tree. Added file
+// is a rename of a deleted file, or a copy of a file which is kept or already renamed
+func (n *Native) detectRenames(oldTree string, changes []Change) ([]Change, error) {
+	added := make([]int, 0)
+	deleted := make(map[string]int)
+	modified := make(map[string]bool)
+
+	for idx, ch := range changes {
+		switch ch.Status {
+		case 'A':
+			added = append(added, idx)
+		case 'D':
+			deleted[ch.Path] = idx
+		default:
+			modified[ch.OldPath] = true
+		}
+	}
+
+	if len(added) == 0 || oldTree == "" {
+		return changes, nil
+	}
+
+	// Unmodified files are copy sources too, like with `--find-copies-harder`
+	sources := make([]TreeFile, 0)
+	if err := n.listTree("", oldTree, &sources); err != nil {
+		return nil, err
+	}
+
+	paired := make(map[int]bool)
+	renamed := make(map[int]bool)
+
+	pair := func(src TreeFile, a int) {
+		changes[a].Status = 'C'
+		if d, ok := deleted[src.Path]; ok && !renamed[d] {
+			changes[a].Status = 'R'
+			renamed[d] = true
+		}
+		changes[a].OldPath = src.Path
+		changes[a].OldBlob = src.Hash
+		paired[a] = true
+	}
+
+	// Exact renames first, then exact copies
+	for _, a := range added {
+		for _, exactRename := range []bool{true, false} {
+			for _, src := range sources {
+				d, isDeleted := deleted[src.Path]
+				if paired[a] || src.Hash != changes[a].NewBlob || (exactRename && (!isDeleted || renamed[d])) {
+					continue
+				}
+				pair(src, a)
+			}
+		}
+	}
+
+	// Like git, fall back to sources changed by the commit if the tree is too large
+	candidates := func(changedOnly bool) []TreeFile {
+		result := make([]TreeFile, 0)
+		for _, src := range sources {
+			_, isDeleted := deleted[src.Path]
+			if !changedOnly || isDeleted || modified[src.Path] {
+				result = append(result, src)
+			}
+		}
+		return result
+	}
+
+	unpaired := 0
+	for _, a := range added {
+		if !paired[a] {
+			unpaired += 1
+		}
+	}
+
+	inexact := sources
+	if unpaired*len(inexact) > renameLimit*renameLimit {
+		inexact = candidates(true)
+	}
+
+	if unpaired > 0 && unpaired*len(inexact) <= renameLimit*renameLimit {
+		type candidate struct {
+			src   TreeFile
+			a     int
+			score float64
+		}
+
+		pairs := make([]candidate, 0)
+		contents := make(map[string][]byte)
+		sizes := make(map[string]int64)
+
+		read := func(hash string) ([]byte, error) {
+			if c, ok := contents[hash]; ok {
+				return c, nil
+			}
+			c, err := n.ReadBlob(hash)
+			contents[hash] = c
+			return c, err
+		}
+
+		size := func(hash string) (int64, error) {
+			if s, ok := sizes[hash]; ok {
+				return s, nil
+			}
+			s, err := n.BlobSize(hash)
+			sizes[hash] = s
+			return s, err
+		}
+
+		for _, a := range added {
+			if paired[a] {
+				continue
+			}
+
+			dstSize, err := size(changes[a].NewBlob)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, src := range inexact {
+				// Sizes are compared first to avoid reading content of every file in the tree
+				srcSize, err := size(src.Hash)
+				if err != nil {
+					return nil, err
+				}
+				if float64(min(srcSize, dstSize)) < renameThreshold*float64(max(srcSize, dstSize)) {
+					continue
+				}
+
+				srcContent, err := read(src.Hash)
+				if err != nil {
+					return nil, err
+				}
+
+				dstContent, err := read(changes[a].NewBlob)
+				if err != nil {
+					return nil, err
+				}
+
+				if score := similarity(srcContent, dstContent); score >= renameThreshold {
+					pairs = append(pairs, candidate{src, a, score})
+				}
+			}
+		}
+
+		// Deleted sources are preferred on equal score, so that they're renamed rather than copied
+		slices.SortStableFunc(pairs, func(x, y candidate) int {
+			if x.score != y.score {
+				if x.score > y.score {
+					return -1
+				}
+				return 1
+			}
+			_, xDeleted := deleted[x.src.Path]
+			_, yDeleted := deleted[y.src.Path]
+			if xDeleted != yDeleted {
+				if xDeleted {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(changes[x.a].Path, changes[y.a].Path)
+		})
+
+		for _, p := range pairs {
+			if !paired[p.a] {
+				pair(p.src, p.a)
+			}
+		}
+	}
+
+	result := make([]Change, 0, len(changes)-len(renamed))
+	for idx, ch := range changes {
+		if ch.Status == 'D' && renamed[idx] {
+			continue
+		}
+		result = append(result, ch)
+	}
+
+	return result, nil
+}
+
+// similarity estimates share of `dst` content copied from `src`
+// by counting bytes of common lines, similarly to git's rename score
+func similarity(src, dst []byte) float64 {
+	maxSize := max(len(src), len(dst))
+	if maxSize == 0 {
+		return 1
+	}
+
+	// Files of too different sizes can't be similar enough
+	if float64(min(len(src), len(dst)))/float64(maxSize) < renameThreshold {
+		return 0
+	}
+
+	lines := make(map[string]int)
+	for _, l := range bytes.SplitAfter(src, []byte("\n")) {
+		lines[string(l)] += 1
+	}
+
+	common := 0
+	for _, l := range bytes.SplitAfter(dst, []byte("\n")) {
+		if lines[string(l)] > 0 {
+			lines[string(l)] -= 1
+			common += len(l)
+		}
+	}
+
+	return float64(common) / float64(maxSize)
+}
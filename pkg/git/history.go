@@ -0,0 +1,60 @@
+package git
+
+import (
+	"time"
+)
+
+type Commit struct {
+	Hash        string
+	AuthorName  string
+	AuthorEmail string
+	AuthorDate  time.Time
+	Message     string
+	Changes     []Change
+}
+
+type Change struct {
+	Status  byte   // one of 'A', 'M', 'D', 'R', 'C', 'T'
+	Path    string // path after the change (deleted path for 'D')
+	OldPath string // path before the change, differs from `Path` for renames and copies
+	OldBlob string
+	NewBlob string
+}
+
+// History is a list of commits reachable from `Head`, newest first
+type History struct {
+	Head    string
+	Shallow bool
+	Commits []Commit
+}
+
+type FileCommit struct {
+	Commit *Commit
+	Change Change
+}
+
+// FileLog returns commits changing the file at `path` (relative to the repository root),
+// newest first, following renames and copies like `git log --follow` does
+func (h *History) FileLog(path string) []FileCommit {
+	log := make([]FileCommit, 0)
+
+	for idx := range h.Commits {
+		c := &h.Commits[idx]
+
+		for _, ch := range c.Changes {
+			if ch.Path != path {
+				continue
+			}
+
+			log = append(log, FileCommit{c, ch})
+
+			if ch.Status == 'R' || ch.Status == 'C' {
+				path = ch.OldPath
+			}
+
+			break
+		}
+	}
+
+	return log
+}
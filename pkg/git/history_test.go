@@ -0,0 +1,188 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLogAndFileLog(t *testing.T) {
+	blob := strings.Repeat("a", 40)
+	out := strings.Join([]string{
+		recordSep + "c4" + fieldSep + "2024-01-04T10:00:00Z" + fieldSep + "A" + fieldSep + "a@b" + fieldSep + "copy\n\x00\n" +
+			":100644 100644 " + blob + " " + blob + " C100\x00posts/b.md\x00posts/e.md\x00",
+		recordSep + "c3" + fieldSep + "2024-01-03T10:00:00Z" + fieldSep + "A" + fieldSep + "a@b" + fieldSep + "edit\n\x00\n" +
+			":100644 100644 " + blob + " " + blob + " M\x00posts/b.md\x00:000000 100644 " + blob + " " + blob + " A\x00posts/c d.md\x00",
+		recordSep + "c2" + fieldSep + "2024-01-02T10:00:00Z" + fieldSep + "A" + fieldSep + "a@b" + fieldSep + "merge\n\x00",
+		recordSep + "c1" + fieldSep + "2024-01-01T10:00:00Z" + fieldSep + "B" + fieldSep + "b@b" + fieldSep + "rename\n\nbody\n\x00\n" +
+			":100644 100644 " + blob + " " + blob + " R095\x00posts/a.md\x00posts/b.md\x00",
+		recordSep + "c0" + fieldSep + "2024-01-01T09:00:00Z" + fieldSep + "B" + fieldSep + "b@b" + fieldSep + "init\n\x00\n" +
+			":000000 100644 " + blob + " " + blob + " A\x00posts/a.md\x00",
+	}, "")
+
+	commits, err := parseLog(out)
+	if err != nil {
+		t.Fatalf("parseLog: unexpected error: %v", err)
+	}
+
+	if len(commits) != 5 || commits[3].Message != "rename\n\nbody" || commits[3].AuthorEmail != "b@b" || len(commits[2].Changes) != 0 {
+		t.Fatalf("parseLog: unexpected commits: %v", commits)
+	}
+
+	h := History{Head: "c4", Commits: commits}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"posts/b.md", []string{"c3", "c1", "c0"}},
+		{"posts/c d.md", []string{"c3"}},
+		{"posts/e.md", []string{"c4", "c3", "c1", "c0"}},
+		{"posts/x.md", []string{}},
+	}
+
+	for idx, test := range tests {
+		hashes := make([]string, 0)
+		for _, fc := range h.FileLog(test.path) {
+			hashes = append(hashes, fc.Commit.Hash)
+		}
+
+		if !reflect.DeepEqual(hashes, test.expected) {
+			t.Errorf("%v) FileLog('%v'): expected '%v' but got '%v'", idx, test.path, test.expected, hashes)
+		}
+	}
+}
+
+func TestFileLogMatchesFollow(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git executable is not available")
+	}
+
+	dir := t.TempDir()
+	date := 0
+
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL=/dev/null",
+			fmt.Sprintf("GIT_AUTHOR_DATE=2024-01-01T10:%02d:00Z", date),
+			fmt.Sprintf("GIT_COMMITTER_DATE=2024-01-01T10:%02d:00Z", date),
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(path string) string {
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	commit := func(msg string) {
+		date += 1
+		run("add", "-A")
+		run("commit", "-q", "-m", msg)
+	}
+
+	lines := func(n int, suffix string) string {
+		b := strings.Builder{}
+		for i := range n {
+			fmt.Fprintf(&b, "line %v of the post %v\n", i, suffix)
+		}
+		return b.String()
+	}
+
+	run("init", "-q", "-b", "main")
+	run("config", "user.name", "Author")
+	run("config", "user.email", "author@example.com")
+
+	write("posts/a.md", lines(20, "a"))
+	write("posts/b.md", lines(20, "b"))
+	write("posts/template.md", lines(20, "template"))
+	write("posts/nested/c.md", lines(20, "c"))
+	commit("init")
+
+	write("posts/a.md", lines(21, "a"))
+	commit("edit")
+
+	write("posts/e.md", read("posts/a.md"))
+	commit("exact copy of unmodified file")
+
+	write("posts/e.md", lines(22, "a"))
+	commit("edit copy")
+
+	write("posts/f.md", read("posts/template.md")+"draft\n")
+	write("posts/template.md", lines(19, "template"))
+	commit("similar copy of modified file")
+
+	write("posts/d/b.md", read("posts/b.md")+"one more line\n")
+	run("rm", "-q", "posts/b.md")
+	commit("similar rename")
+
+	run("mv", "posts/a.md", "posts/h.md")
+	write("posts/i.md", read("posts/h.md"))
+	commit("rename and copy of the same file")
+
+	run("checkout", "-q", "-b", "feature")
+	write("posts/nested/c.md", lines(21, "c"))
+	commit("feature")
+
+	run("checkout", "-q", "main")
+	write("posts/g.md", read("posts/nested/c.md")+"copied on main\n")
+	commit("main")
+
+	date += 1
+	run("merge", "-q", "--no-ff", "feature", "-m", "merge")
+
+	native, err := OpenNative(dir)
+	if err != nil {
+		t.Fatalf("OpenNative: %v", err)
+	}
+
+	for _, repo := range []Repo{NewCli(dir), native} {
+		commits, err := repo.Log("HEAD")
+		if err != nil {
+			t.Fatalf("%T: Log: %v", repo, err)
+		}
+
+		h := History{Commits: commits}
+
+		files, err := repo.ListTree(commits[0].Hash)
+		if err != nil {
+			t.Fatalf("%T: ListTree: %v", repo, err)
+		}
+
+		for _, f := range files {
+			expected := strings.Fields(run("log", "--follow", "--format=%H", "--", f.Path))
+
+			got := make([]string, 0)
+			for _, fc := range h.FileLog(f.Path) {
+				got = append(got, fc.Commit.Hash)
+			}
+
+			if !reflect.DeepEqual(expected, got) {
+				t.Errorf("%T: FileLog('%v'): expected %v but got %v", repo, f.Path, expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,713 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Native reads repository history directly from `.git` directory
+// (loose objects and packfiles) without `git` executable
+type Native struct {
+	toplevel  string
+	gitDir    string
+	commonDir string
+	objects   *objectStore
+}
+
+// OpenNative finds repository containing `dir` by looking for `.git` in `dir` and its parents
+func OpenNative(dir string) (*Native, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		dotGit := filepath.Join(abs, ".git")
+
+		if stat, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+
+			if !stat.IsDir() {
+				// Worktrees and submodules have `.git` file pointing to the actual git directory
+				if gitDir, err = readGitDirFile(dotGit); err != nil {
+					return nil, err
+				}
+			}
+
+			return openNative(abs, gitDir)
+		}
+
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return nil, fmt.Errorf("git.OpenNative: %w (or any of the parent directories): %v", ErrNotRepository, dir)
+		}
+		abs = parent
+	}
+}
+
+func readGitDirFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("git.OpenNative: invalid .git file: %v", path)
+	}
+
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+
+	return gitDir, nil
+}
+
+func openNative(toplevel, gitDir string) (*Native, error) {
+	commonDir := gitDir
+
+	if content, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(content))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	if config, err := os.ReadFile(filepath.Join(commonDir, "config")); err == nil && bytes.Contains(config, []byte("objectformat = sha256")) {
+		return nil, errors.New("git.OpenNative: sha256 repositories are not supported")
+	}
+
+	objects, err := openObjectStore(filepath.Join(commonDir, "objects"))
+	if err != nil {
+		return nil, fmt.Errorf("git.OpenNative: failed to open object store: %v", err)
+	}
+
+	return &Native{toplevel, gitDir, commonDir, objects}, nil
+}
+
+func (n *Native) Toplevel() (string, error) {
+	return n.toplevel, nil
+}
+
+func (n *Native) GitDir() (string, error) {
+	return n.commonDir, nil
+}
+
+func (n *Native) Head() (string, error) {
+	hash, err := n.ResolveRef("HEAD")
+	if errors.Is(err, ErrRefNotFound) {
+		return "", nil
+	}
+
+	return hash, err
+}
+
+var ErrRefNotFound = errors.New("ref not found")
+
+// ResolveRef resolves commit hash (full or abbreviated), `HEAD`, branch, tag or remote name
+// to commit hash. Revision expressions, e.g. `HEAD~1`, require `git` executable
+func (n *Native) ResolveRef(ref string) (string, error) {
+	if isHash(ref) {
+		return n.peel(ref)
+	}
+
+	candidates := []string{ref, "refs/" + ref, "refs/tags/" + ref, "refs/heads/" + ref, "refs/remotes/" + ref}
+
+	for _, name := range candidates {
+		hash, err := n.readRef(name, 0)
+		if errors.Is(err, ErrRefNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return n.peel(hash)
+	}
+
+	// Same as git, ref names take precedence over abbreviated hashes
+	if isShortHash(ref) {
+		hash, err := n.resolveShortHash(ref)
+		if err != nil {
+			return "", err
+		}
+
+		return n.peel(hash)
+	}
+
+	if strings.ContainsAny(ref, "~^:@{}") {
+		return "", fmt.Errorf("%w: %v: full hash or ref name required without git executable", ErrRefNotFound, ref)
+	}
+
+	return "", fmt.Errorf("%w: %v", ErrRefNotFound, ref)
+}
+
+// resolveShortHash returns full hash of the only object starting with `prefix`
+func (n *Native) resolveShortHash(prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+
+	matches, err := n.objects.findPrefix(prefix, 2)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %v", ErrRefNotFound, prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous short hash %v, use more characters", prefix)
+	}
+}
+
+// Close closes packfiles of the repository
+func (n *Native) Close() error {
+	return n.objects.close()
+}
+
+func (n *Native) readRef(name string, depth int) (string, error) {
+	if depth > 8 {
+		return "", fmt.Errorf("too many levels of symbolic refs: %v", name)
+	}
+
+	dir := n.commonDir
+	if name == "HEAD" {
+		dir = n.gitDir
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+
+	if err == nil {
+		value := strings.TrimSpace(string(content))
+
+		if target, ok := strings.CutPrefix(value, "ref: "); ok {
+			return n.readRef(target, depth+1)
+		}
+
+		if !isHash(value) {
+			return "", fmt.Errorf("invalid ref %v: %q", name, value)
+		}
+
+		return value, nil
+	}
+
+	// Missing loose ref (or a directory with the same name, e.g. `refs/heads`) can still be packed
+	return n.readPackedRef(name)
+}
+
+func (n *Native) readPackedRef(name string) (string, error) {
+	f, err := os.Open(filepath.Join(n.commonDir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %v", ErrRefNotFound, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+
+		hash, ref, ok := strings.Cut(line, " ")
+		if ok && ref == name {
+			return hash, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("%w: %v", ErrRefNotFound, name)
+}
+
+// peel dereferences annotated tags to the commits they point to
+func (n *Native) peel(hash string) (string, error) {
+	for range 8 {
+		obj, err := n.objects.read(hash)
+		if err != nil {
+			return "", err
+		}
+
+		if obj.typ != objTag {
+			return hash, nil
+		}
+
+		target, _, _ := strings.Cut(string(obj.data), "\n")
+		hash, _ = strings.CutPrefix(target, "object ")
+	}
+
+	return "", fmt.Errorf("too many levels of nested tags: %v", hash)
+}
+
+// shallowCommits returns commits whose parents are missing in shallow clones
+func (n *Native) shallowCommits() (map[string]bool, error) {
+	shallow := make(map[string]bool)
+
+	content, err := os.ReadFile(filepath.Join(n.commonDir, "shallow"))
+	if errors.Is(err, os.ErrNotExist) {
+		return shallow, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Fields(string(content)) {
+		shallow[line] = true
+	}
+
+	return shallow, nil
+}
+
+// Log returns commits reachable from `ref` ordered by commit date, newest first, like `git log` does.
+// Changes are computed against the first parent with rename detection, merge commits have no changes
+func (n *Native) Log(ref string) ([]Commit, error) {
+	head, err := n.ResolveRef(ref)
+	if err != nil {
+		return nil, fmt.Errorf("git.Log: failed to resolve %v: %v", ref, err)
+	}
+
+	shallow, err := n.shallowCommits()
+	if err != nil {
+		return nil, fmt.Errorf("git.Log: failed to read shallow commits: %v", err)
+	}
+
+	commits := make([]Commit, 0)
+	seen := map[string]bool{head: true}
+	queue := &commitQueue{}
+
+	push := func(hash string) error {
+		c, err := n.readCommit(hash)
+		if err != nil {
+			return err
+		}
+		queue.seq += 1
+		heap.Push(queue, queuedCommit{c, queue.seq})
+		return nil
+	}
+
+	if err := push(head); err != nil {
+		return nil, fmt.Errorf("git.Log: %v", err)
+	}
+
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(queuedCommit).commit
+
+		parents := c.parents
+		if shallow[c.hash] {
+			parents = []string{}
+		}
+
+		commit := Commit{
+			Hash:        c.hash,
+			AuthorName:  c.authorName,
+			AuthorEmail: c.authorEmail,
+			AuthorDate:  c.authorDate,
+			Message:     c.message,
+			Changes:     []Change{},
+		}
+
+		if len(parents) <= 1 {
+			parentTree := ""
+			if len(parents) == 1 {
+				parent, err := n.readCommit(parents[0])
+				if err != nil {
+					return nil, fmt.Errorf("git.Log: %v", err)
+				}
+				parentTree = parent.tree
+			}
+
+			changes, err := n.diffTrees(parentTree, c.tree)
+			if err != nil {
+				return nil, fmt.Errorf("git.Log: failed to diff commit %v: %v", c.hash, err)
+			}
+			commit.Changes = changes
+		}
+
+		commits = append(commits, commit)
+
+		for _, p := range parents {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			if err := push(p); err != nil {
+				return nil, fmt.Errorf("git.Log: %v", err)
+			}
+		}
+	}
+
+	return commits, nil
+}
+
+// ReadFile returns content of the file at `path` in the tree of commit `hash`
+func (n *Native) ReadFile(hash string, path string) ([]byte, error) {
+	blob, err := n.lookupPath(hash, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.ReadBlob(blob)
+}
+
+// Modified reports whether working tree file at `path` differs from its version in HEAD
+func (n *Native) Modified(path string) (bool, error) {
+	head, err := n.Head()
+	if err != nil || head == "" {
+		return false, err
+	}
+
+	blob, err := n.lookupPath(head, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(n.toplevel, filepath.FromSlash(path)))
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+
+	return hex.EncodeToString(h.Sum(nil)) != blob, nil
+}
+
+func (n *Native) IsShallow() (bool, error) {
+	shallow, err := n.shallowCommits()
+	return len(shallow) > 0, err
+}
+
+func (n *Native) Unshallow() error {
+	return errors.New("git.Unshallow: fetching history requires `git` executable")
+}
+
+// lookupPath returns hash of the tree entry at `path` in the tree of commit `hash`
+func (n *Native) lookupPath(hash string, path string) (string, error) {
+	c, err := n.readCommit(hash)
+	if err != nil {
+		return "", err
+	}
+
+	entryHash := c.tree
+	for _, name := range strings.Split(path, "/") {
+		entries, err := n.readTree(entryHash)
+		if err != nil {
+			return "", err
+		}
+
+		found := false
+		for _, e := range entries {
+			if e.name == name {
+				entryHash = e.hash
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return "", fmt.Errorf("%w: %v:%v", os.ErrNotExist, hash, path)
+		}
+	}
+
+	return entryHash, nil
+}
+
+func (n *Native) ReadBlob(hash string) ([]byte, error) {
+	if hash == zeroHash {
+		return []byte{}, nil
+	}
+
+	obj, err := n.objects.read(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.typ != objBlob {
+		return nil, fmt.Errorf("expected %v to be a blob", hash)
+	}
+
+	return obj.data, nil
+}
+
+func (n *Native) BlobSize(hash string) (int64, error) {
+	if hash == zeroHash {
+		return 0, nil
+	}
+
+	typ, size, err := n.objects.header(hash)
+	if err != nil {
+		return 0, err
+	}
+
+	if typ != objBlob {
+		return 0, fmt.Errorf("expected %v to be a blob", hash)
+	}
+
+	return size, nil
+}
+
+type rawCommit struct {
+	hash          string
+	tree          string
+	parents       []string
+	authorName    string
+	authorEmail   string
+	authorDate    time.Time
+	committerDate time.Time
+	message       string
+}
+
+func (n *Native) readCommit(hash string) (rawCommit, error) {
+	obj, err := n.objects.read(hash)
+	if err != nil {
+		return rawCommit{}, fmt.Errorf("failed to read commit %v: %v", hash, err)
+	}
+
+	if obj.typ != objCommit {
+		return rawCommit{}, fmt.Errorf("expected %v to be a commit", hash)
+	}
+
+	return parseCommit(hash, obj.data)
+}
+
+func parseCommit(hash string, data []byte) (rawCommit, error) {
+	c := rawCommit{hash: hash, parents: []string{}}
+
+	headers, message, _ := bytes.Cut(data, []byte("\n\n"))
+	c.message = strings.TrimSpace(string(message))
+
+	for _, line := range strings.Split(string(headers), "\n") {
+		// Continuation lines of multi-line headers (e.g. `gpgsig`) start with space
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "tree":
+			c.tree = value
+		case "parent":
+			c.parents = append(c.parents, value)
+		case "author":
+			name, email, date, err := parseSignature(value)
+			if err != nil {
+				return c, fmt.Errorf("invalid author of commit %v: %v", hash, err)
+			}
+			c.authorName, c.authorEmail, c.authorDate = name, email, date
+		case "committer":
+			_, _, date, err := parseSignature(value)
+			if err != nil {
+				return c, fmt.Errorf("invalid committer of commit %v: %v", hash, err)
+			}
+			c.committerDate = date
+		}
+	}
+
+	if c.tree == "" {
+		return c, fmt.Errorf("invalid commit %v: missing tree", hash)
+	}
+
+	return c, nil
+}
+
+// parseSignature parses `Name <email> 1700000000 +0100`
+func parseSignature(s string) (string, string, time.Time, error) {
+	lt := strings.LastIndex(s, "<")
+	gt := strings.LastIndex(s, ">")
+
+	if lt == -1 || gt < lt {
+		return "", "", time.Time{}, fmt.Errorf("unexpected signature: %q", s)
+	}
+
+	name := strings.TrimSpace(s[:lt])
+	email := s[lt+1 : gt]
+	fields := strings.Fields(s[gt+1:])
+
+	if len(fields) != 2 {
+		return "", "", time.Time{}, fmt.Errorf("unexpected signature date: %q", s)
+	}
+
+	sec, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("unexpected signature timestamp: %q", s)
+	}
+
+	tz := fields[1]
+	if len(tz) != 5 {
+		return "", "", time.Time{}, fmt.Errorf("unexpected signature timezone: %q", s)
+	}
+
+	hours, errH := strconv.Atoi(tz[1:3])
+	minutes, errM := strconv.Atoi(tz[3:5])
+	if errH != nil || errM != nil {
+		return "", "", time.Time{}, fmt.Errorf("unexpected signature timezone: %q", s)
+	}
+
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	return name, email, time.Unix(sec, 0).In(time.FixedZone("", offset)), nil
+}
+
+func (n *Native) ListTree(hash string) ([]TreeFile, error) {
+	c, err := n.readCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]TreeFile, 0)
+	if err := n.listTree("", c.tree, &files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (n *Native) listTree(prefix string, hash string, files *[]TreeFile) error {
+	entries, err := n.readTree(hash)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := prefix + e.name
+
+		if e.isDir() {
+			if err := n.listTree(path+"/", e.hash, files); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Submodules point to commits of other repositories
+		if e.mode == "160000" {
+			continue
+		}
+
+		*files = append(*files, TreeFile{path, e.mode, e.hash})
+	}
+
+	return nil
+}
+
+type treeEntry struct {
+	mode string
+	name string
+	hash string
+}
+
+func (e treeEntry) isDir() bool {
+	return e.mode == "40000"
+}
+
+func (n *Native) readTree(hash string) ([]treeEntry, error) {
+	entries := make([]treeEntry, 0)
+
+	if hash == "" {
+		return entries, nil
+	}
+
+	obj, err := n.objects.read(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree %v: %v", hash, err)
+	}
+
+	if obj.typ != objTree {
+		return nil, fmt.Errorf("expected %v to be a tree", hash)
+	}
+
+	data := obj.data
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < 20 {
+			return nil, fmt.Errorf("invalid tree %v", hash)
+		}
+
+		mode, name, _ := strings.Cut(string(header), " ")
+		entries = append(entries, treeEntry{mode, name, hex.EncodeToString(rest[:20])})
+		data = rest[20:]
+	}
+
+	return entries, nil
+}
+
+// isShortHash reports whether `s` can be an abbreviated hash, which git requires to be at least 4 characters long
+func isShortHash(s string) bool {
+	if len(s) < 4 || len(s) >= 40 {
+		return false
+	}
+
+	_, err := hex.DecodeString(s + strings.Repeat("0", len(s)%2))
+	return err == nil
+}
+
+func isHash(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+type queuedCommit struct {
+	commit rawCommit
+	seq    int
+}
+
+// commitQueue pops commits with the latest commit date first,
+// preserving insertion order for commits with equal dates
+type commitQueue struct {
+	items []queuedCommit
+	seq   int
+}
+
+func (q commitQueue) Len() int { return len(q.items) }
+
+func (q commitQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+
+	if !a.commit.committerDate.Equal(b.commit.committerDate) {
+		return a.commit.committerDate.After(b.commit.committerDate)
+	}
+
+	return a.seq < b.seq
+}
+
+func (q commitQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *commitQueue) Push(x any) { q.items = append(q.items, x.(queuedCommit)) }
+
+func (q *commitQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
@@ -0,0 +1,331 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNativeLogMatchesCli(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git executable is not available")
+	}
+
+	dir := t.TempDir()
+	date := 0
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL=/dev/null",
+			fmt.Sprintf("GIT_AUTHOR_DATE=2024-01-01T10:%02d:00+02:00", date),
+			fmt.Sprintf("GIT_COMMITTER_DATE=2024-01-01T10:%02d:00+02:00", date),
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commit := func(msg string) {
+		date += 1
+		run("add", "-A")
+		run("commit", "-q", "-m", msg)
+	}
+
+	lines := func(n int, suffix string) string {
+		b := strings.Builder{}
+		for i := range n {
+			fmt.Fprintf(&b, "line %v of the post %v\n", i, suffix)
+		}
+		return b.String()
+	}
+
+	run("init", "-q", "-b", "main")
+	run("config", "user.name", "Author")
+	run("config", "user.email", "author@example.com")
+
+	write("posts/a.md", lines(20, "a"))
+	write("posts/b.md", lines(20, "b"))
+	write("posts/nested/c.md", lines(20, "c"))
+	commit("init\n\nwith body")
+
+	run("mv", "posts/a.md", "posts/renamed-a.md")
+	commit("exact rename")
+
+	run("mv", "posts/b.md", "posts/renamed-b.md")
+	write("posts/renamed-b.md", lines(20, "b")+"one more line\n")
+	commit("similar rename")
+
+	run("checkout", "-q", "-b", "feature")
+	write("posts/nested/c.md", lines(21, "c"))
+	commit("feature")
+
+	run("checkout", "-q", "main")
+	write("posts/d.md", lines(5, "d"))
+	commit("main")
+
+	date += 1
+	run("merge", "-q", "--no-ff", "feature", "-m", "merge")
+
+	run("rm", "-q", "-r", "posts/nested")
+	commit("delete directory")
+
+	compare := func(name string) {
+		cliCommits, err := NewCli(dir).Log("HEAD")
+		if err != nil {
+			t.Fatalf("%v: Cli.Log: %v", name, err)
+		}
+
+		native, err := OpenNative(filepath.Join(dir, "posts"))
+		if err != nil {
+			t.Fatalf("%v: OpenNative: %v", name, err)
+		}
+
+		nativeCommits, err := native.Log("HEAD")
+		if err != nil {
+			t.Fatalf("%v: Native.Log: %v", name, err)
+		}
+
+		normalize := func(commits []Commit) []string {
+			result := make([]string, 0)
+			for _, c := range commits {
+				changes := make([]string, 0)
+				for _, ch := range c.Changes {
+					changes = append(changes, fmt.Sprintf("%c %v %v %v %v", ch.Status, ch.OldPath, ch.Path, ch.OldBlob, ch.NewBlob))
+				}
+				slices.Sort(changes)
+				result = append(result, fmt.Sprintf("%v %v <%v> %v %q %v", c.Hash, c.AuthorName, c.AuthorEmail, c.AuthorDate.Format("2006-01-02T15:04:05Z07:00"), c.Message, changes))
+			}
+			return result
+		}
+
+		if expected, got := normalize(cliCommits), normalize(nativeCommits); !reflect.DeepEqual(expected, got) {
+			t.Errorf("%v: expected\n%v\nbut got\n%v", name, strings.Join(expected, "\n"), strings.Join(got, "\n"))
+		}
+
+		content, err := native.ReadFile(nativeCommits[0].Hash, "posts/renamed-b.md")
+		if err != nil || string(content) != lines(20, "b")+"one more line\n" {
+			t.Errorf("%v: ReadFile: unexpected content %q, %v", name, content, err)
+		}
+
+		cliTree, err := NewCli(dir).ListTree(cliCommits[0].Hash)
+		if err != nil {
+			t.Fatalf("%v: Cli.ListTree: %v", name, err)
+		}
+
+		nativeTree, err := native.ListTree(nativeCommits[0].Hash)
+		if err != nil {
+			t.Fatalf("%v: Native.ListTree: %v", name, err)
+		}
+
+		if !reflect.DeepEqual(cliTree, nativeTree) {
+			t.Errorf("%v: ListTree: expected %v but got %v", name, cliTree, nativeTree)
+		}
+
+		// Blobs are read by a single `git cat-file` process, which is restarted after failures
+		cli := NewCli(dir)
+		for idx, f := range append(cliTree, TreeFile{Hash: strings.Repeat("1", 40)}, cliTree[0]) {
+			cliBlob, cliErr := cli.ReadBlob(f.Hash)
+			nativeBlob, nativeErr := native.ReadBlob(f.Hash)
+
+			if (cliErr != nil) != (nativeErr != nil) || !bytes.Equal(cliBlob, nativeBlob) {
+				t.Errorf("%v: %v) ReadBlob(%v): expected %q, %v but got %q, %v", name, idx, f.Hash, nativeBlob, nativeErr, cliBlob, cliErr)
+			}
+
+			cliSize, cliErr := cli.BlobSize(f.Hash)
+			nativeSize, nativeErr := native.BlobSize(f.Hash)
+
+			if (cliErr != nil) != (nativeErr != nil) || cliSize != int64(len(nativeBlob)) || nativeSize != int64(len(nativeBlob)) {
+				t.Errorf("%v: %v) BlobSize(%v): expected %v but got %v, %v (cli) and %v, %v (native)", name, idx, f.Hash, len(nativeBlob), cliSize, cliErr, nativeSize, nativeErr)
+			}
+		}
+
+		tree, err := NewTreeFs(native, "main")
+		if err != nil {
+			t.Fatalf("%v: NewTreeFs: %v", name, err)
+		}
+
+		// Sizes are read without reading files' content
+		info, err := fs.Stat(tree, "posts/renamed-b.md")
+		if err != nil || info.Size() != int64(len(lines(20, "b")+"one more line\n")) || len(tree.blobs) != 0 {
+			t.Errorf("%v: TreeFs.Stat: unexpected info %v, %v with %v blobs read", name, info, err, len(tree.blobs))
+		}
+
+		if err := fstest.TestFS(tree, "posts/d.md", "posts/renamed-a.md", "posts/renamed-b.md"); err != nil {
+			t.Errorf("%v: TreeFs: %v", name, err)
+		}
+	}
+
+	compare("loose objects")
+
+	run("gc", "-q", "--aggressive")
+	compare("packed objects")
+}
+
+func TestOpenOutsideRepository(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := OpenNative(dir); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("native: expected ErrNotRepository but got %v", err)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	if _, err := NewCli(dir).Toplevel(); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("cli: expected ErrNotRepository but got %v", err)
+	}
+}
+
+func TestNativeResolveRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git executable is not available")
+	}
+
+	dir := t.TempDir()
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	commit := func(path string) string {
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", path)
+		return git("rev-parse", "HEAD")
+	}
+
+	git("init", "-q", "-b", "main")
+	git("config", "user.name", "Author")
+	git("config", "user.email", "author@example.com")
+
+	c0 := commit("a.md")
+	c1 := commit("b.md")
+	git("tag", "-a", "-m", "tag", "v1")
+
+	// Blobs with the same 4 characters prefix make it ambiguous
+	ambiguous := ""
+	prefixes := make(map[string]string)
+	for i := 0; ambiguous == ""; i++ {
+		content := fmt.Sprintf("blob %v", i)
+		hash := fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("blob %v\x00%v", len(content), content))))
+
+		other, ok := prefixes[hash[:4]]
+		if !ok {
+			prefixes[hash[:4]] = content
+			continue
+		}
+
+		for _, c := range []string{other, content} {
+			if err := os.WriteFile(filepath.Join(dir, "blob"), []byte(c), 0644); err != nil {
+				t.Fatal(err)
+			}
+			git("hash-object", "-w", "blob")
+		}
+		ambiguous = hash[:4]
+	}
+
+	// Ref names take precedence over abbreviated hashes
+	git("branch", c0[:7], c1)
+
+	tests := []struct {
+		ref      string
+		expected string
+		err      string
+	}{
+		{c0, c0, ""},
+		{"HEAD", c1, ""},
+		{"v1", c1, ""},
+		{c0[:12], c0, ""},
+		{strings.ToUpper(c1[:8]), c1, ""},
+		{c0[:7], c1, ""},
+		{ambiguous, "", "ambiguous short hash"},
+		{"0000000", "", ErrRefNotFound.Error()},
+		{"abc", "", ErrRefNotFound.Error()},
+		{"HEAD~1", "", "full hash or ref name required without git executable"},
+		{"main^", "", "full hash or ref name required without git executable"},
+	}
+
+	resolve := func(name string) {
+		native, err := OpenNative(dir)
+		if err != nil {
+			t.Fatalf("%v: OpenNative: %v", name, err)
+		}
+		defer native.Close()
+
+		for idx, test := range tests {
+			got, err := native.ResolveRef(test.ref)
+
+			if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("%v: %v) ResolveRef(%v): expected error '%v' but got %v", name, idx, test.ref, test.err, err)
+				continue
+			}
+
+			if got != test.expected {
+				t.Errorf("%v: %v) ResolveRef(%v): expected %v but got %v", name, idx, test.ref, test.expected, got)
+			}
+
+			// Resolved refs match git, which also supports revision expressions
+			if cli, err := NewCli(dir).ResolveRef(test.ref); test.err == "" && (err != nil || cli != got) {
+				t.Errorf("%v: %v) Cli.ResolveRef(%v): expected %v but got %v, %v", name, idx, test.ref, got, cli, err)
+			}
+		}
+	}
+
+	resolve("loose objects")
+
+	git("gc", "-q")
+	resolve("packed objects")
+
+	native, err := OpenNative(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packs := native.objects.packs
+	if len(packs) == 0 {
+		t.Fatalf("OpenNative: expected packs to be opened")
+	}
+
+	if err := native.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for _, p := range packs {
+		if _, err := p.file.Stat(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("Close: expected pack to be closed but got %v", err)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type objectType int
+
+const (
+	objCommit   objectType = 1
+	objTree     objectType = 2
+	objBlob     objectType = 3
+	objTag      objectType = 4
+	objOfsDelta objectType = 6
+	objRefDelta objectType = 7
+)
+
+var objectTypeNames = map[string]objectType{
+	"commit": objCommit,
+	"tree":   objTree,
+	"blob":   objBlob,
+	"tag":    objTag,
+}
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type object struct {
+	typ  objectType
+	data []byte
+}
+
+// objectStore reads loose and packed objects from `.git/objects` directory
+type objectStore struct {
+	dir   string
+	packs []*pack
+
+	mu    sync.Mutex
+	cache map[string]object
+}
+
+// Decoded objects are cached to avoid re-inflating trees and delta bases
+// shared by neighbouring commits
+const objectCacheSize = 4096
+
+func openObjectStore(dir string) (*objectStore, error) {
+	store := &objectStore{dir: dir, cache: make(map[string]object)}
+
+	idxPaths, err := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, idxPath := range idxPaths {
+		p, err := openPack(strings.TrimSuffix(idxPath, ".idx"))
+		if err != nil {
+			store.close()
+			return nil, fmt.Errorf("failed to open pack %v: %v", idxPath, err)
+		}
+		store.packs = append(store.packs, p)
+	}
+
+	return store, nil
+}
+
+func (s *objectStore) read(hash string) (object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readLocked(hash)
+}
+
+func (s *objectStore) readLocked(hash string) (object, error) {
+	if obj, ok := s.cache[hash]; ok {
+		return obj, nil
+	}
+
+	obj, err := s.readLoose(hash)
+
+	if errors.Is(err, ErrObjectNotFound) {
+		obj, err = s.readPacked(hash)
+	}
+
+	if err != nil {
+		return object{}, err
+	}
+
+	if len(s.cache) >= objectCacheSize {
+		clear(s.cache)
+	}
+	s.cache[hash] = obj
+
+	return obj, nil
+}
+
+// header returns type and size of the object `hash` without reading its content
+func (s *objectStore) header(hash string) (objectType, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.headerLocked(hash)
+}
+
+func (s *objectStore) headerLocked(hash string) (objectType, int64, error) {
+	if obj, ok := s.cache[hash]; ok {
+		return obj.typ, int64(len(obj.data)), nil
+	}
+
+	typ, size, err := s.headerLoose(hash)
+
+	if errors.Is(err, ErrObjectNotFound) {
+		typ, size, err = s.headerPacked(hash)
+	}
+
+	return typ, size, err
+}
+
+func (s *objectStore) readLoose(hash string) (object, error) {
+	if len(hash) != 40 {
+		return object{}, fmt.Errorf("invalid object hash: %q", hash)
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, hash[:2], hash[2:]))
+	if errors.Is(err, os.ErrNotExist) {
+		return object{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return object{}, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return object{}, fmt.Errorf("failed to read loose object %v: %v", hash, err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return object{}, fmt.Errorf("failed to read loose object %v: %v", hash, err)
+	}
+
+	header, data, ok := bytes.Cut(raw, []byte{0})
+	if !ok {
+		return object{}, fmt.Errorf("invalid loose object %v: missing header", hash)
+	}
+
+	typeName, sizeStr, _ := strings.Cut(string(header), " ")
+	typ, ok := objectTypeNames[typeName]
+	if !ok {
+		return object{}, fmt.Errorf("invalid loose object %v: unexpected type %q", hash, typeName)
+	}
+
+	if size, err := strconv.Atoi(sizeStr); err != nil || size != len(data) {
+		return object{}, fmt.Errorf("invalid loose object %v: unexpected size %q", hash, sizeStr)
+	}
+
+	return object{typ, data}, nil
+}
+
+func (s *objectStore) readPacked(hash string) (object, error) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return object{}, fmt.Errorf("invalid object hash: %q", hash)
+	}
+
+	for _, p := range s.packs {
+		offset, ok := p.find(raw)
+		if !ok {
+			continue
+		}
+
+		return p.readAt(offset, s.readLocked)
+	}
+
+	return object{}, fmt.Errorf("%w: %v", ErrObjectNotFound, hash)
+}
+
+func (s *objectStore) headerLoose(hash string) (objectType, int64, error) {
+	if len(hash) != 40 {
+		return 0, 0, fmt.Errorf("invalid object hash: %q", hash)
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, hash[:2], hash[2:]))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, ErrObjectNotFound
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read loose object %v: %v", hash, err)
+	}
+	defer zr.Close()
+
+	// Header is short, only its first bytes are inflated
+	header, err := bufio.NewReaderSize(zr, 64).ReadString(0)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid loose object %v: missing header", hash)
+	}
+
+	typeName, sizeStr, _ := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	typ, ok := objectTypeNames[typeName]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid loose object %v: unexpected type %q", hash, typeName)
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid loose object %v: unexpected size %q", hash, sizeStr)
+	}
+
+	return typ, size, nil
+}
+
+func (s *objectStore) headerPacked(hash string) (objectType, int64, error) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return 0, 0, fmt.Errorf("invalid object hash: %q", hash)
+	}
+
+	for _, p := range s.packs {
+		offset, ok := p.find(raw)
+		if !ok {
+			continue
+		}
+
+		return p.headerAt(offset, s.headerLocked)
+	}
+
+	return 0, 0, fmt.Errorf("%w: %v", ErrObjectNotFound, hash)
+}
+
+// applyDelta reconstructs object from `base` using git's delta instructions
+// findPrefix returns hashes of loose and packed objects starting with hex `prefix`,
+// stopping after `limit` distinct matches
+func (s *objectStore) findPrefix(prefix string, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	matches := make([]string, 0)
+
+	add := func(hash string) {
+		if !seen[hash] && len(matches) < limit {
+			seen[hash] = true
+			matches = append(matches, hash)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, prefix[:2]))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if hash := prefix[:2] + e.Name(); isHash(hash) && strings.HasPrefix(hash, prefix) {
+			add(hash)
+		}
+	}
+
+	for _, p := range s.packs {
+		for _, hash := range p.findPrefix(prefix, limit) {
+			add(hash)
+		}
+	}
+
+	return matches, nil
+}
+
+// close closes packfiles, objects can't be read afterwards
+func (s *objectStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, p := range s.packs {
+		if err := p.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.packs = nil
+
+	return errors.Join(errs...)
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+
+	readSize := func() (int, error) {
+		size, shift := 0, 0
+		for {
+			if pos >= len(delta) {
+				return 0, errors.New("truncated delta header")
+			}
+			b := delta[pos]
+			pos += 1
+			size |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+
+	baseSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch: expected %v, got %v", baseSize, len(base))
+	}
+
+	targetSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, targetSize)
+
+	for pos < len(delta) {
+		cmd := delta[pos]
+		pos += 1
+
+		switch {
+		case cmd&0x80 != 0:
+			offset, size := 0, 0
+
+			for i := 0; i < 4; i++ {
+				if cmd&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated delta copy instruction")
+					}
+					offset |= int(delta[pos]) << (8 * i)
+					pos += 1
+				}
+			}
+
+			for i := 0; i < 3; i++ {
+				if cmd&(0x10<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated delta copy instruction")
+					}
+					size |= int(delta[pos]) << (8 * i)
+					pos += 1
+				}
+			}
+
+			if size == 0 {
+				size = 0x10000
+			}
+
+			if offset+size > len(base) {
+				return nil, errors.New("delta copy instruction out of base bounds")
+			}
+
+			out = append(out, base[offset:offset+size]...)
+		case cmd != 0:
+			if pos+int(cmd) > len(delta) {
+				return nil, errors.New("truncated delta insert instruction")
+			}
+
+			out = append(out, delta[pos:pos+int(cmd)]...)
+			pos += int(cmd)
+		default:
+			return nil, errors.New("unexpected delta instruction")
+		}
+	}
+
+	if len(out) != targetSize {
+		return nil, fmt.Errorf("delta target size mismatch: expected %v, got %v", targetSize, len(out))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,306 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pack reads objects from packfile using its version 2 index
+type pack struct {
+	file    *os.File
+	fanout  [256]uint32
+	hashes  []byte
+	offsets []byte
+	large   []byte
+
+	// Cache of resolved delta bases by their offset in the packfile
+	bases map[int64]object
+}
+
+func openPack(path string) (*pack, error) {
+	idx, err := os.ReadFile(path + ".idx")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(idx[4:8]) != 2 {
+		return nil, errors.New("unsupported pack index format, expected version 2")
+	}
+
+	p := &pack{bases: make(map[int64]object)}
+
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+	}
+
+	count := int(p.fanout[255])
+	pos := 8 + 256*4
+
+	if len(idx) < pos+count*(20+4+4) {
+		return nil, errors.New("truncated pack index")
+	}
+
+	p.hashes = idx[pos : pos+count*20]
+	pos += count * 20
+	pos += count * 4 // crc32 checksums
+	p.offsets = idx[pos : pos+count*4]
+	pos += count * 4
+	p.large = idx[pos:]
+
+	p.file, err = os.Open(path + ".pack")
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *pack) find(hash []byte) (int64, bool) {
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(p.fanout[hash[0]-1])
+	}
+	hi := int(p.fanout[hash[0]])
+
+	for lo < hi {
+		mid := (lo + hi) / 2
+		cmp := bytes.Compare(p.hashes[mid*20:mid*20+20], hash)
+
+		switch {
+		case cmp == 0:
+			return p.offset(mid), true
+		case cmp < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return 0, false
+}
+
+// findPrefix returns hashes of the objects starting with hex `prefix`, stopping after `limit` matches
+func (p *pack) findPrefix(prefix string, limit int) []string {
+	// Lower bound of the prefix padded with zeros to a whole number of bytes
+	low, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2))
+	if err != nil || len(low) == 0 {
+		return nil
+	}
+
+	lo := 0
+	if low[0] > 0 {
+		lo = int(p.fanout[low[0]-1])
+	}
+	hi := int(p.fanout[low[0]])
+
+	idx := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.hashes[(lo+i)*20:(lo+i)*20+20], low) >= 0
+	})
+
+	matches := make([]string, 0)
+	for ; idx < hi && len(matches) < limit; idx++ {
+		hash := hex.EncodeToString(p.hashes[idx*20 : idx*20+20])
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		matches = append(matches, hash)
+	}
+
+	return matches
+}
+
+func (p *pack) close() error {
+	return p.file.Close()
+}
+
+func (p *pack) offset(idx int) int64 {
+	offset := binary.BigEndian.Uint32(p.offsets[idx*4:])
+
+	if offset&0x80000000 == 0 {
+		return int64(offset)
+	}
+
+	largeIdx := int(offset & 0x7fffffff)
+	return int64(binary.BigEndian.Uint64(p.large[largeIdx*8:]))
+}
+
+const packBaseCacheSize = 1024
+
+// readAt reads object at `offset` resolving deltas. Bases of `ref` deltas
+// are read with `readByHash`, since they can be stored outside of this pack
+func (p *pack) readAt(offset int64, readByHash func(hash string) (object, error)) (object, error) {
+	if obj, ok := p.bases[offset]; ok {
+		return obj, nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+
+	typ, size, err := readPackedHeader(r)
+	if err != nil {
+		return object{}, err
+	}
+
+	var base object
+
+	switch typ {
+	case objCommit, objTree, objBlob, objTag:
+	case objOfsDelta:
+		rel, err := readBaseOffset(r)
+		if err != nil {
+			return object{}, err
+		}
+
+		if base, err = p.readAt(offset-rel, readByHash); err != nil {
+			return object{}, fmt.Errorf("failed to read delta base: %v", err)
+		}
+	case objRefDelta:
+		hash := make([]byte, 20)
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return object{}, err
+		}
+
+		if base, err = readByHash(hex.EncodeToString(hash)); err != nil {
+			return object{}, fmt.Errorf("failed to read delta base: %v", err)
+		}
+	default:
+		return object{}, fmt.Errorf("unexpected packed object type %v at offset %v", typ, offset)
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return object{}, err
+	}
+	defer zr.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return object{}, fmt.Errorf("failed to inflate packed object at offset %v: %v", offset, err)
+	}
+
+	obj := object{typ, data}
+
+	if typ == objOfsDelta || typ == objRefDelta {
+		resolved, err := applyDelta(base.data, data)
+		if err != nil {
+			return object{}, fmt.Errorf("failed to apply delta at offset %v: %v", offset, err)
+		}
+		obj = object{base.typ, resolved}
+	}
+
+	if len(p.bases) >= packBaseCacheSize {
+		clear(p.bases)
+	}
+	p.bases[offset] = obj
+
+	return obj, nil
+}
+
+// headerAt returns type and size of object at `offset` without inflating its content.
+// Size of a delta is read from the beginning of its instructions, and type from its base
+func (p *pack) headerAt(offset int64, headerByHash func(hash string) (objectType, int64, error)) (objectType, int64, error) {
+	if obj, ok := p.bases[offset]; ok {
+		return obj.typ, int64(len(obj.data)), nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+
+	typ, size, err := readPackedHeader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var baseTyp objectType
+
+	switch typ {
+	case objCommit, objTree, objBlob, objTag:
+		return typ, size, nil
+	case objOfsDelta:
+		rel, err := readBaseOffset(r)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if baseTyp, _, err = p.headerAt(offset-rel, headerByHash); err != nil {
+			return 0, 0, fmt.Errorf("failed to read delta base: %v", err)
+		}
+	case objRefDelta:
+		hash := make([]byte, 20)
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return 0, 0, err
+		}
+
+		if baseTyp, _, err = headerByHash(hex.EncodeToString(hash)); err != nil {
+			return 0, 0, fmt.Errorf("failed to read delta base: %v", err)
+		}
+	default:
+		return 0, 0, fmt.Errorf("unexpected packed object type %v at offset %v", typ, offset)
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer zr.Close()
+
+	// Delta instructions start with sizes of the base and the target encoded the same way as varints
+	delta := bufio.NewReader(zr)
+	if _, err := binary.ReadUvarint(delta); err != nil {
+		return 0, 0, fmt.Errorf("failed to read delta header at offset %v: %v", offset, err)
+	}
+
+	targetSize, err := binary.ReadUvarint(delta)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read delta header at offset %v: %v", offset, err)
+	}
+
+	return baseTyp, int64(targetSize), nil
+}
+
+// readPackedHeader reads type and size of packed object, for deltas it's the size of instructions
+func readPackedHeader(r *bufio.Reader) (objectType, int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	typ := objectType((b >> 4) & 0x7)
+	size := int64(b & 0x0f)
+	shift := 4
+
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(b&0x7f) << shift
+		shift += 7
+	}
+
+	return typ, size, nil
+}
+
+// readBaseOffset reads relative offset of `ofs` delta's base
+func readBaseOffset(r *bufio.Reader) (int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	rel := int64(b & 0x7f)
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		rel = ((rel + 1) << 7) | int64(b&0x7f)
+	}
+
+	return rel, nil
+}
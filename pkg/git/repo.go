@@ -0,0 +1,53 @@
+package git
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Repo reads history of a git repository
+type Repo interface {
+	// Toplevel returns absolute path of the repository's working tree root
+	Toplevel() (string, error)
+	// GitDir returns path to the repository's `.git` directory shared by all worktrees
+	GitDir() (string, error)
+	// Head returns hash of the HEAD commit, or empty string for repository without commits
+	Head() (string, error)
+	// ResolveRef returns hash of the commit `ref` points to
+	ResolveRef(ref string) (string, error)
+	// ListTree returns all files in the tree of commit `hash`
+	ListTree(hash string) ([]TreeFile, error)
+	// Log returns commits reachable from `ref` with their changes, newest first
+	Log(ref string) ([]Commit, error)
+	// ReadBlob returns content of the blob `hash`, or empty content for zero hash
+	ReadBlob(hash string) ([]byte, error)
+	// BlobSize returns size of the blob `hash` without reading its content
+	BlobSize(hash string) (int64, error)
+	// Modified reports whether file at `path` (relative to the toplevel) has uncommitted changes
+	Modified(path string) (bool, error)
+	// IsShallow reports whether repository is a shallow clone with truncated history
+	IsShallow() (bool, error)
+	// Unshallow fetches the missing history of a shallow clone
+	Unshallow() error
+	// Close releases files and processes used to read the repository
+	Close() error
+}
+
+type TreeFile struct {
+	Path string // slash-separated path relative to the repository root
+	Mode string
+	Hash string
+}
+
+// ErrNotRepository is returned when directory is not inside of a git repository
+var ErrNotRepository = errors.New("not a git repository")
+
+// Open returns repository containing `dir`. Repository is read using `git` executable
+// if it's available on PATH, or directly from `.git` directory otherwise
+func Open(dir string) (Repo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return OpenNative(dir)
+	}
+
+	return NewCli(dir), nil
+}
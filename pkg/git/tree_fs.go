@@ -0,0 +1,217 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TreeFs is a read-only in-memory file system with files of a commit's tree.
+// Files' content is read from the repository on first access
+type TreeFs struct {
+	repo  Repo
+	files map[string]TreeFile
+	dirs  map[string][]string // directory path to sorted names of its entries
+
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+// NewTreeFs returns file system with the tree of the commit `ref` resolves to
+func NewTreeFs(repo Repo, ref string) (*TreeFs, error) {
+	hash, err := repo.ResolveRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := repo.ListTree(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TreeFs{
+		repo:  repo,
+		files: make(map[string]TreeFile, len(files)),
+		dirs:  make(map[string][]string),
+		blobs: make(map[string][]byte),
+	}
+
+	children := map[string]map[string]bool{".": {}}
+
+	for _, f := range files {
+		t.files[f.Path] = f
+
+		for p := f.Path; p != "."; p = path.Dir(p) {
+			dir := path.Dir(p)
+			if children[dir] == nil {
+				children[dir] = make(map[string]bool)
+			}
+			children[dir][path.Base(p)] = true
+		}
+	}
+
+	for dir, names := range children {
+		t.dirs[dir] = slices.Sorted(maps.Keys(names))
+	}
+
+	return t, nil
+}
+
+func (t *TreeFs) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if _, ok := t.dirs[name]; ok {
+		entries, err := t.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &treeDir{treeInfo{path.Base(name), 0, fs.ModeDir | 0555}, entries, 0}, nil
+	}
+
+	f, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	content, err := t.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &treeFile{fileInfo(f, int64(len(content))), bytes.NewReader(content)}, nil
+}
+
+func (t *TreeFs) ReadFile(name string) ([]byte, error) {
+	f, ok := t.files[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Callers are free to modify returned content
+	if content, ok := t.blobs[f.Hash]; ok {
+		return bytes.Clone(content), nil
+	}
+
+	content, err := t.repo.ReadBlob(f.Hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	t.blobs[f.Hash] = bytes.Clone(content)
+
+	return content, nil
+}
+
+func (t *TreeFs) ReadDir(name string) ([]fs.DirEntry, error) {
+	names, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, n := range names {
+		info, err := t.Stat(path.Join(name, n))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	return entries, nil
+}
+
+func (t *TreeFs) Stat(name string) (fs.FileInfo, error) {
+	if _, ok := t.dirs[name]; ok {
+		return treeInfo{path.Base(name), 0, fs.ModeDir | 0555}, nil
+	}
+
+	f, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if content, ok := t.blobs[f.Hash]; ok {
+		return fileInfo(f, int64(len(content))), nil
+	}
+
+	// Size is read from the object's header, content is read on open
+	size, err := t.repo.BlobSize(f.Hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return fileInfo(f, size), nil
+}
+
+func fileInfo(f TreeFile, size int64) treeInfo {
+	mode := fs.FileMode(0444)
+	if f.Mode == "100755" {
+		mode = 0555
+	}
+
+	return treeInfo{path.Base(f.Path), size, mode}
+}
+
+type treeInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (i treeInfo) Name() string       { return i.name }
+func (i treeInfo) Size() int64        { return i.size }
+func (i treeInfo) Mode() fs.FileMode  { return i.mode }
+func (i treeInfo) ModTime() time.Time { return time.Time{} }
+func (i treeInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i treeInfo) Sys() any           { return nil }
+
+type treeFile struct {
+	info treeInfo
+	*bytes.Reader
+}
+
+func (f *treeFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *treeFile) Close() error               { return nil }
+
+type treeDir struct {
+	info    treeInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *treeDir) Close() error               { return nil }
+
+func (d *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *treeDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	n := min(count, len(rest))
+	d.offset += n
+
+	return rest[:n], nil
+}
@@ -0,0 +1,521 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"slices"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+)
+
+// Variant is an image downscaled to `Width` pixels wide
+type Variant struct {
+	Width   int
+	Content []byte
+}
+
+// imageParts is a jpeg or png file split into segments, so that metadata
+// can be removed or copied into re-encoded image without decoding it
+type imageParts struct {
+	head     []byte   // jpeg SOI marker or png signature
+	segments [][]byte // jpeg marker segments preceding image data, or png chunks
+	tail     []byte   // jpeg image data starting with SOS marker, empty for png
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Chunks removed from png when stripping metadata
+var pngMetadata = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+// Chunks affecting how png is displayed, copied into re-encoded png
+var pngDisplay = map[string]bool{"iCCP": true, "sRGB": true, "gAMA": true, "cHRM": true, "pHYs": true}
+
+// Optimize returns optimized content of jpeg or png image. Other assets are returned
+// as is. Image wider than max width is always downscaled, while image re-encoded at its
+// original width is returned only if it comes out smaller. Color profile, and
+// orientation of jpeg are kept even if metadata is stripped
+func Optimize(content []byte, cfg config.ConfigCdnImages) ([]byte, error) {
+	if Settings(cfg) == "" {
+		return content, nil
+	}
+
+	format, parts, err := split(content)
+	if err != nil {
+		return nil, fmt.Errorf("Optimize: %v", err)
+	}
+	if format == "" {
+		return content, nil
+	}
+
+	best := content
+	if cfg.StripMetadata {
+		if format == JPEG {
+			best = stripJpeg(parts)
+		} else {
+			best = stripPng(parts)
+		}
+	}
+
+	width, ok := displayWidth(content, format, parts)
+	if !ok {
+		return best, nil
+	}
+
+	resize := cfg.MaxWidth > 0 && width > cfg.MaxWidth
+	if !resize && !cfg.Reencode {
+		return best, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("Optimize: failed to decode %v: %v", format, err)
+	}
+
+	if resize {
+		img = scale(img, width, cfg.MaxWidth)
+	}
+
+	optimized, err := encode(format, img, parts, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Optimize: failed to encode %v: %v", format, err)
+	}
+
+	// Re-encoding of the image at its original width is kept only if it's smaller
+	if !resize && len(optimized) >= len(best) {
+		return best, nil
+	}
+
+	return optimized, nil
+}
+
+// Settings returns description of the optimization settings, which changes
+// whenever optimized content may change. Empty if optimization is disabled
+func Settings(cfg config.ConfigCdnImages) string {
+	if !cfg.StripMetadata && cfg.MaxWidth == 0 && !cfg.Reencode {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"strip_metadata=%v,max_width=%v,reencode=%v,jpeg_quality=%v",
+		cfg.StripMetadata, cfg.MaxWidth, cfg.Reencode, cfg.JpegQuality,
+	)
+}
+
+// Width returns displayed width of jpeg or png image which can be resized.
+// Returns false for other assets, animated png and cmyk jpeg images
+func Width(content []byte) (int, bool) {
+	format, parts, err := split(content)
+	if err != nil || format == "" {
+		return 0, false
+	}
+
+	return displayWidth(content, format, parts)
+}
+
+// Widths returns sorted unique `widths` smaller than `width`
+func Widths(width int, widths []int) []int {
+	smaller := make([]int, 0, len(widths))
+
+	for _, w := range widths {
+		if w < width && !slices.Contains(smaller, w) {
+			smaller = append(smaller, w)
+		}
+	}
+
+	slices.Sort(smaller)
+	return smaller
+}
+
+// Variants returns image downscaled to each of `widths`, which must be smaller than its Width
+func Variants(content []byte, widths []int, cfg config.ConfigCdnImages) ([]Variant, error) {
+	format, parts, err := split(content)
+	if err != nil {
+		return nil, fmt.Errorf("Variants: %v", err)
+	}
+
+	width, ok := displayWidth(content, format, parts)
+	if !ok {
+		return nil, fmt.Errorf("Variants: image can't be resized")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("Variants: failed to decode %v: %v", format, err)
+	}
+
+	variants := make([]Variant, 0, len(widths))
+
+	for _, w := range widths {
+		if w >= width {
+			return nil, fmt.Errorf("Variants: width %v is not smaller than %v", w, width)
+		}
+
+		resized, err := encode(format, scale(img, width, w), parts, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("Variants: failed to encode %v: %v", format, err)
+		}
+
+		variants = append(variants, Variant{w, resized})
+	}
+
+	return variants, nil
+}
+
+// split returns format of jpeg or png image and its parts, or empty format for other content
+func split(content []byte) (string, imageParts, error) {
+	var parts imageParts
+	var err error
+
+	format := http.DetectContentType(content)
+
+	switch format {
+	case JPEG:
+		parts, err = splitJpeg(content)
+	case PNG:
+		parts, err = splitPng(content)
+	default:
+		return "", imageParts{}, nil
+	}
+	if err != nil {
+		return "", imageParts{}, fmt.Errorf("failed to parse %v: %v", format, err)
+	}
+
+	return format, parts, nil
+}
+
+func displayWidth(content []byte, format string, parts imageParts) (int, bool) {
+	// Only the first frame of animated png is decoded
+	if format == PNG && parts.hasPngChunk("acTL") {
+		return 0, false
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+
+	// Color profile of cmyk jpeg doesn't apply to re-encoded rgb image
+	if err != nil || cfg.ColorModel == color.CMYKModel {
+		return 0, false
+	}
+
+	// Images rotated by 90 degrees are displayed with width and height swapped
+	if format == JPEG && jpegOrientation(parts) >= 5 {
+		return cfg.Height, true
+	}
+
+	return cfg.Width, true
+}
+
+func encode(format string, img image.Image, original imageParts, cfg config.ConfigCdnImages) ([]byte, error) {
+	if format == JPEG {
+		return encodeJpeg(img, original, cfg)
+	}
+
+	return encodePng(img, original, cfg)
+}
+
+// scale downscales image displayed `width` pixels wide to `maxWidth`
+func scale(img image.Image, width, maxWidth int) image.Image {
+	ratio := float64(maxWidth) / float64(width)
+	b := img.Bounds()
+
+	return downscale(img, max(int(float64(b.Dx())*ratio+0.5), 1), max(int(float64(b.Dy())*ratio+0.5), 1))
+}
+
+// downscale resizes image to smaller `width` and `height`, averaging source pixels covered by each pixel
+func downscale(img image.Image, width, height int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		y0, y1 := y*b.Dy()/height, (y+1)*b.Dy()/height
+
+		for x := range width {
+			x0, x1 := x*b.Dx()/width, (x+1)*b.Dx()/width
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			offset := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[offset+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+func (parts imageParts) join() []byte {
+	var b bytes.Buffer
+
+	b.Write(parts.head)
+	for _, s := range parts.segments {
+		b.Write(s)
+	}
+	b.Write(parts.tail)
+
+	return b.Bytes()
+}
+
+func splitJpeg(content []byte) (imageParts, error) {
+	if len(content) < 2 || content[0] != 0xff || content[1] != 0xd8 {
+		return imageParts{}, fmt.Errorf("missing SOI marker")
+	}
+
+	parts := imageParts{head: content[:2]}
+
+	for pos := 2; ; {
+		if pos+4 > len(content) || content[pos] != 0xff {
+			return imageParts{}, fmt.Errorf("invalid marker at %v", pos)
+		}
+
+		marker := content[pos+1]
+
+		// Fill bytes
+		if marker == 0xff {
+			pos += 1
+			continue
+		}
+
+		// SOS
+		if marker == 0xda {
+			parts.tail = content[pos:]
+			return parts, nil
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(content[pos+2:]))
+		if end < pos+4 || end > len(content) {
+			return imageParts{}, fmt.Errorf("invalid length of segment at %v", pos)
+		}
+
+		parts.segments = append(parts.segments, content[pos:end])
+		pos = end
+	}
+}
+
+// isJpegMetadata reports whether segment is exif or xmp (APP1), iptc (APP13) or comment
+func isJpegMetadata(segment []byte) bool {
+	return segment[1] == 0xe1 || segment[1] == 0xed || segment[1] == 0xfe
+}
+
+func isJpegColorProfile(segment []byte) bool {
+	return segment[1] == 0xe2 && bytes.HasPrefix(segment[4:], []byte("ICC_PROFILE\x00"))
+}
+
+// stripJpeg removes metadata segments, replacing exif with the one containing only orientation
+func stripJpeg(parts imageParts) []byte {
+	segments := make([][]byte, 0, len(parts.segments))
+
+	for _, s := range parts.segments {
+		if o := exifOrientation(s); o > 1 {
+			segments = append(segments, orientationSegment(o))
+		} else if !isJpegMetadata(s) {
+			segments = append(segments, s)
+		}
+	}
+
+	parts.segments = segments
+	return parts.join()
+}
+
+// encodeJpeg encodes image with color profile and metadata (or only orientation) of the original
+func encodeJpeg(img image.Image, original imageParts, cfg config.ConfigCdnImages) ([]byte, error) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: cfg.JpegQuality}); err != nil {
+		return nil, err
+	}
+
+	encoded, err := splitJpeg(b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([][]byte, 0, len(original.segments)+len(encoded.segments))
+
+	for _, s := range original.segments {
+		if o := exifOrientation(s); o > 1 && cfg.StripMetadata {
+			segments = append(segments, orientationSegment(o))
+		} else if isJpegColorProfile(s) || (isJpegMetadata(s) && !cfg.StripMetadata) {
+			segments = append(segments, s)
+		}
+	}
+
+	encoded.segments = append(segments, encoded.segments...)
+	return encoded.join(), nil
+}
+
+// jpegOrientation returns exif orientation of the image, 1 if it's not rotated
+func jpegOrientation(parts imageParts) int {
+	for _, s := range parts.segments {
+		if o := exifOrientation(s); o > 0 {
+			return o
+		}
+	}
+
+	return 1
+}
+
+// exifOrientation returns orientation tag of exif segment, or 0 if it's missing
+func exifOrientation(segment []byte) int {
+	if segment[1] != 0xe1 || !bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+		return 0
+	}
+
+	tiff := segment[10:]
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for idx := range count {
+		entry := ifd + 2 + idx*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		// Orientation tag of SHORT type
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 0
+}
+
+// orientationSegment returns exif segment containing only orientation tag
+func orientationSegment(orientation int) []byte {
+	s := []byte{0xff, 0xe1, 0, 0}
+	s = append(s, "Exif\x00\x00"...)
+	s = append(s, "MM\x00\x2a\x00\x00\x00\x08"...)
+	s = binary.BigEndian.AppendUint16(s, 1)      // number of entries
+	s = binary.BigEndian.AppendUint16(s, 0x0112) // orientation tag
+	s = binary.BigEndian.AppendUint16(s, 3)      // SHORT type
+	s = binary.BigEndian.AppendUint32(s, 1)      // number of values
+	s = binary.BigEndian.AppendUint16(s, uint16(orientation))
+	s = append(s, 0, 0)       // padding of the value
+	s = append(s, 0, 0, 0, 0) // offset of the next IFD
+
+	binary.BigEndian.PutUint16(s[2:], uint16(len(s)-2))
+	return s
+}
+
+func splitPng(content []byte) (imageParts, error) {
+	if !bytes.HasPrefix(content, pngSignature) {
+		return imageParts{}, fmt.Errorf("missing png signature")
+	}
+
+	parts := imageParts{head: content[:len(pngSignature)]}
+
+	for pos := len(pngSignature); ; {
+		if pos+12 > len(content) {
+			return imageParts{}, fmt.Errorf("missing IEND chunk")
+		}
+
+		// Length, type, data and crc
+		end := pos + 12 + int(binary.BigEndian.Uint32(content[pos:]))
+		if end < pos+12 || end > len(content) {
+			return imageParts{}, fmt.Errorf("invalid length of chunk at %v", pos)
+		}
+
+		chunk := content[pos:end]
+		parts.segments = append(parts.segments, chunk)
+		pos = end
+
+		if pngChunkType(chunk) == "IEND" {
+			return parts, nil
+		}
+	}
+}
+
+func pngChunkType(chunk []byte) string {
+	return string(chunk[4:8])
+}
+
+func (parts imageParts) hasPngChunk(chunkType string) bool {
+	for _, c := range parts.segments {
+		if pngChunkType(c) == chunkType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stripPng(parts imageParts) []byte {
+	chunks := make([][]byte, 0, len(parts.segments))
+
+	for _, c := range parts.segments {
+		if !pngMetadata[pngChunkType(c)] {
+			chunks = append(chunks, c)
+		}
+	}
+
+	parts.segments = chunks
+	return parts.join()
+}
+
+// encodePng encodes image with best compression, and copies display settings
+// and metadata of the original next to the header chunk
+func encodePng(img image.Image, original imageParts, cfg config.ConfigCdnImages) ([]byte, error) {
+	var b bytes.Buffer
+
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&b, img); err != nil {
+		return nil, err
+	}
+
+	encoded, err := splitPng(b.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, len(original.segments)+len(encoded.segments))
+	chunks = append(chunks, encoded.segments[0])
+
+	for _, c := range original.segments {
+		if t := pngChunkType(c); pngDisplay[t] || (pngMetadata[t] && !cfg.StripMetadata) {
+			chunks = append(chunks, c)
+		}
+	}
+
+	encoded.segments = append(chunks, encoded.segments[1:]...)
+	return encoded.join(), nil
+}
@@ -0,0 +1,199 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+
+	"github.com/mtratsiuk/b3/pkg/config"
+)
+
+func TestOptimize(t *testing.T) {
+	gpsExif := []byte("\xff\xe1\x00\x2eExif\x00\x00II\x2a\x00\x08\x00\x00\x00\x02\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x25\x88\x04\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	comment := []byte("\xff\xfe\x00\x08secret")
+
+	photo := withJpegSegments(encodeTestJpeg(t, 40, 20), gpsExif, comment)
+	screenshot := encodeTestPng(t, 40, 20, true)
+	dithered := encodeTestPalettedPng(t, 64, 64)
+	text := []byte("<svg></svg>")
+
+	tests := []struct {
+		name        string
+		content     []byte
+		cfg         config.ConfigCdnImages
+		width       int
+		height      int
+		orientation int
+		metadata    bool
+		same        bool
+	}{
+		{"disabled", photo, config.ConfigCdnImages{}, 40, 20, 6, true, true},
+		{"not an image", text, config.ConfigCdnImages{StripMetadata: true, MaxWidth: 10, Reencode: true}, 0, 0, 0, false, true},
+		{"jpeg stripped", photo, config.ConfigCdnImages{StripMetadata: true}, 40, 20, 6, false, false},
+		{"rotated jpeg downscaled by displayed width", photo, config.ConfigCdnImages{MaxWidth: 10, JpegQuality: 85}, 20, 10, 6, true, false},
+		{"rotated jpeg narrower than max width", photo, config.ConfigCdnImages{MaxWidth: 20, JpegQuality: 85}, 40, 20, 6, true, true},
+		{"jpeg downscaled and stripped", photo, config.ConfigCdnImages{MaxWidth: 5, StripMetadata: true, JpegQuality: 85}, 10, 5, 6, false, false},
+		{"png downscaled", screenshot, config.ConfigCdnImages{MaxWidth: 10}, 10, 5, 0, false, false},
+		{"png not smaller after re-encoding", screenshot, config.ConfigCdnImages{Reencode: true}, 40, 20, 0, false, true},
+		{"png downscaled even if larger", dithered, config.ConfigCdnImages{MaxWidth: 48}, 48, 48, 0, false, false},
+	}
+
+	for _, test := range tests {
+		result, err := Optimize(test.content, test.cfg)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if same := bytes.Equal(result, test.content); same != test.same {
+			t.Errorf("%v: expected unchanged content to be %v", test.name, test.same)
+		}
+
+		if test.width == 0 {
+			continue
+		}
+
+		img, _, err := image.Decode(bytes.NewReader(result))
+		if err != nil {
+			t.Errorf("%v: failed to decode result: %v", test.name, err)
+			continue
+		}
+
+		if b := img.Bounds(); b.Dx() != test.width || b.Dy() != test.height {
+			t.Errorf("%v: expected %vx%v image but got %vx%v", test.name, test.width, test.height, b.Dx(), b.Dy())
+		}
+
+		if test.orientation == 0 {
+			continue
+		}
+
+		parts, err := splitJpeg(result)
+		if err != nil {
+			t.Errorf("%v: failed to parse result: %v", test.name, err)
+			continue
+		}
+
+		if o := jpegOrientation(parts); o != test.orientation {
+			t.Errorf("%v: expected orientation %v but got %v", test.name, test.orientation, o)
+		}
+
+		hasMetadata := bytes.Contains(result, comment) && bytes.Contains(result, gpsExif)
+		if hasMetadata != test.metadata {
+			t.Errorf("%v: expected metadata to be kept %v", test.name, test.metadata)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	// Rotated by exif orientation, displayed 20 pixels wide
+	photo := withJpegSegments(encodeTestJpeg(t, 40, 20), orientationSegment(6))
+
+	width, ok := Width(photo)
+	if !ok || width != 20 {
+		t.Fatalf("expected displayed width 20 but got %v, %v", width, ok)
+	}
+
+	if _, ok := Width([]byte("<svg></svg>")); ok {
+		t.Errorf("expected svg not to be resizable")
+	}
+
+	widths := Widths(width, []int{30, 10, 20, 5, 10})
+	if !slices.Equal(widths, []int{5, 10}) {
+		t.Fatalf("expected widths [5 10] but got %v", widths)
+	}
+
+	variants, err := Variants(photo, widths, config.ConfigCdnImages{JpegQuality: 85})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, v := range variants {
+		if w, _ := Width(v.Content); v.Width != widths[idx] || w != widths[idx] {
+			t.Errorf("%v) expected variant %v pixels wide but got %v displayed %v pixels wide", idx, widths[idx], v.Width, w)
+		}
+	}
+}
+
+func TestStripPng(t *testing.T) {
+	content := encodeTestPng(t, 4, 4, false)
+	parts, err := splitPng(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := []byte("\x00\x00\x00\x07tEXtGPS\x00123\x00\x00\x00\x00")
+	parts.segments = slices.Insert(parts.segments, 1, text)
+
+	stripped := stripPng(parts)
+	if !bytes.Equal(stripped, content) {
+		t.Errorf("expected text chunk to be removed")
+	}
+}
+
+func encodeTestJpeg(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			img.Set(x, y, color.RGBA{uint8(x * 6), uint8(y * 12), 128, 255})
+		}
+	}
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func withJpegSegments(content []byte, segments ...[]byte) []byte {
+	result := bytes.Clone(content[:2])
+	for _, s := range segments {
+		result = append(result, s...)
+	}
+
+	return append(result, content[2:]...)
+}
+
+// encodeTestPng returns black or noisy png encoded with the best compression
+func encodeTestPng(t *testing.T, width, height int, noise bool) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			c := color.NRGBA{0, 0, 0, 255}
+			if noise {
+				c = color.NRGBA{uint8(x*y*31 + 7), uint8(x*17 + y*13), uint8(x ^ y), 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var b bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+// encodeTestPalettedPng returns two-color dithered png, which gets larger when downscaled
+func encodeTestPalettedPng(t *testing.T, width, height int) []byte {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+	for x := range width {
+		for y := range height {
+			img.SetColorIndex(x, y, uint8((x*x+y*7+x*y)%3%2))
+		}
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,130 @@
+package markdown
+
+import (
+	"fmt"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// ImageVariant is a candidate of image `srcset`
+type ImageVariant struct {
+	Url   string
+	Width int
+}
+
+// WithImageVariants renders images with `srcset` of variants returned by `variants` for the
+// image's destination, and with `sizes` attribute. Images without variants are rendered as usual
+func WithImageVariants(variants func(dest string) []ImageVariant, sizes string) goldmark.Option {
+	r := &imageRenderer{Config: html.NewConfig(), variants: variants, sizes: sizes}
+
+	// Registered after goldmark's html renderer, replacing its image rendering
+	return goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(r, 100)))
+}
+
+type imageRenderer struct {
+	html.Config
+	variants func(dest string) []ImageVariant
+	sizes    string
+}
+
+func (r *imageRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindImage, r.renderImage)
+}
+
+// renderImage renders image the same way as goldmark's html renderer, adding `srcset` and `sizes`
+func (r *imageRenderer) renderImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.Image)
+	safe := r.Unsafe || !html.IsDangerousURL(n.Destination)
+
+	_, _ = w.WriteString(`<img src="`)
+	if safe {
+		_, _ = w.Write(util.EscapeHTML(util.URLEscape(n.Destination, true)))
+	}
+	_, _ = w.WriteString(`" alt="`)
+	r.renderTexts(w, source, n)
+	_ = w.WriteByte('"')
+
+	if n.Title != nil {
+		_, _ = w.WriteString(` title="`)
+		r.Writer.Write(w, n.Title)
+		_ = w.WriteByte('"')
+	}
+
+	if safe {
+		r.renderSrcset(w, r.variants(string(n.Destination)))
+	}
+
+	if n.Attributes() != nil {
+		html.RenderAttributes(w, n, html.ImageAttributeFilter)
+	}
+
+	if r.XHTML {
+		_, _ = w.WriteString(" />")
+	} else {
+		_, _ = w.WriteString(">")
+	}
+
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *imageRenderer) renderSrcset(w util.BufWriter, variants []ImageVariant) {
+	if len(variants) == 0 {
+		return
+	}
+
+	_, _ = w.WriteString(` srcset="`)
+	for idx, v := range variants {
+		if idx > 0 {
+			_, _ = w.WriteString(", ")
+		}
+		_, _ = w.Write(util.EscapeHTML(util.URLEscape([]byte(v.Url), true)))
+		_, _ = fmt.Fprintf(w, " %vw", v.Width)
+	}
+	_ = w.WriteByte('"')
+
+	if r.sizes != "" {
+		_, _ = w.WriteString(` sizes="`)
+		_, _ = w.Write(util.EscapeHTML([]byte(r.sizes)))
+		_ = w.WriteByte('"')
+	}
+}
+
+// renderTexts renders text of the image's children as its `alt`
+func (r *imageRenderer) renderTexts(w util.BufWriter, source []byte, n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch t := c.(type) {
+		case *ast.String:
+			if t.IsCode() {
+				_, _ = w.Write(t.Value)
+			} else if t.IsRaw() {
+				r.Writer.RawWrite(w, t.Value)
+			} else {
+				r.Writer.Write(w, t.Value)
+			}
+		case *ast.Text:
+			if t.IsRaw() {
+				r.Writer.RawWrite(w, t.Segment.Value(source))
+				continue
+			}
+
+			r.Writer.Write(w, t.Segment.Value(source))
+			if t.HardLineBreak() && r.XHTML {
+				_, _ = w.WriteString("<br />\n")
+			} else if t.HardLineBreak() {
+				_, _ = w.WriteString("<br>\n")
+			} else if t.SoftLineBreak() {
+				_ = w.WriteByte('\n')
+			}
+		default:
+			r.renderTexts(w, source, c)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package markdown
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yuin/goldmark"
+)
+
+func TestWithImageVariants(t *testing.T) {
+	variants := func(dest string) []ImageVariant {
+		if dest != "a b.png" {
+			return nil
+		}
+
+		return []ImageVariant{{"a b-480w.png", 480}, {"a b.png", 1200}}
+	}
+
+	tests := []struct {
+		source   string
+		expected string // empty if rendered the same as by goldmark
+	}{
+		{"![alt *em* `code` &amp; \\*](c.png \"t&quot;\")", ""},
+		{"![line\nbreak\\\nhard](c.png)", ""},
+		{"![a](javascript:alert(1))", ""},
+		{
+			"![a](<a b.png> \"title\")",
+			"<p><img src=\"a%20b.png\" alt=\"a\" title=\"title\" srcset=\"a%20b-480w.png 480w, a%20b.png 1200w\" sizes=\"(max-width: 1024px) 100vw, 1024px\"></p>\n",
+		},
+	}
+
+	for idx, test := range tests {
+		var expected, result bytes.Buffer
+
+		if err := goldmark.New().Convert([]byte(test.source), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if test.expected != "" {
+			expected.Reset()
+			expected.WriteString(test.expected)
+		}
+
+		md := goldmark.New(WithImageVariants(variants, "(max-width: 1024px) 100vw, 1024px"))
+		if err := md.Convert([]byte(test.source), &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if result.String() != expected.String() {
+			t.Errorf("%v) expected %q but got %q", idx, expected.String(), result.String())
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"slices"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+type RefKind string
+
+const (
+	REF_IMAGE      RefKind = "image"
+	REF_LINK       RefKind = "link"
+	REF_DEFINITION RefKind = "definition"
+	REF_HTML       RefKind = "html"
+)
+
+// Ref is a destination of an image, a link, a link reference definition
+// or an url attribute of an html tag found in markdown source
+type Ref struct {
+	Kind RefKind
+	// Destination with escapes resolved and `<>` brackets removed
+	Dest string
+	// Byte range of the destination as written in the source
+	Start int
+	Stop  int
+}
+
+// Refs returns destinations referenced by markdown source ordered by their position.
+// Destinations are located by parsing the source, so that code blocks and code spans
+// are skipped, and reference-style images and links are found by their definitions
+func Refs(source []byte) []Ref {
+	c := &collector{source: source}
+
+	inlineParsers := parser.DefaultInlineParsers()
+	for idx, p := range inlineParsers {
+		if p.Value == parser.NewLinkParser() {
+			inlineParsers[idx] = util.Prioritized(linkPositions{parser.NewLinkParser(), c}, p.Priority)
+		}
+	}
+
+	p := parser.NewParser(
+		parser.WithBlockParsers(parser.DefaultBlockParsers()...),
+		parser.WithInlineParsers(inlineParsers...),
+		parser.WithParagraphTransformers(
+			util.Prioritized(definitionPositions{parser.LinkReferenceParagraphTransformer, c}, 100),
+		),
+	)
+
+	doc := p.Parse(text.NewReader(source))
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.RawHTML:
+			if n.Segments.Len() > 0 {
+				c.html(n.Segments.At(0).Start, n.Segments.At(n.Segments.Len()-1).Stop)
+			}
+		case *ast.HTMLBlock:
+			lines := n.Lines()
+			if lines.Len() > 0 {
+				stop := lines.At(lines.Len() - 1).Stop
+				if n.HasClosure() {
+					stop = n.ClosureLine.Stop
+				}
+				c.html(lines.At(0).Start, stop)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	slices.SortFunc(c.refs, func(a, b Ref) int {
+		return a.Start - b.Start
+	})
+
+	return slices.CompactFunc(c.refs, func(a, b Ref) bool {
+		return a.Start == b.Start
+	})
+}
+
+// Rewrite replaces destinations of the refs in the source with values returned by `dest`,
+// refs for which `dest` returns false are kept as is
+func Rewrite(source []byte, refs []Ref, dest func(ref Ref) (string, bool)) []byte {
+	result := make([]byte, 0, len(source))
+	last := 0
+
+	for _, ref := range refs {
+		d, ok := dest(ref)
+		if !ok || ref.Start < last {
+			continue
+		}
+
+		result = append(result, source[last:ref.Start]...)
+		result = append(result, d...)
+		last = ref.Stop
+	}
+
+	return append(result, source[last:]...)
+}
+
+type collector struct {
+	source []byte
+	refs   []Ref
+}
+
+// inline records destination of an inline image or link `](dest "title")`
+// with the closing bracket at `start`
+func (c *collector) inline(node ast.Node, start int) {
+	var kind RefKind
+	var dest []byte
+
+	switch n := node.(type) {
+	case *ast.Image:
+		kind, dest = REF_IMAGE, n.Destination
+	case *ast.Link:
+		kind, dest = REF_LINK, n.Destination
+	default:
+		return
+	}
+
+	dest = util.UnescapePunctuations(dest)
+
+	pos := skipSpaces(c.source, start+2)
+	if pos >= len(c.source) {
+		return
+	}
+
+	if c.source[pos] == '<' {
+		stop := pos + 1
+		for stop < len(c.source) && c.source[stop] != '>' && c.source[stop] != '\n' {
+			stop += 1
+		}
+		c.add(kind, string(dest), pos+1, stop)
+		return
+	}
+
+	stop := pos
+	depth := 0
+
+	for ; stop < len(c.source); stop++ {
+		ch := c.source[stop]
+		if ch == '\\' && stop+1 < len(c.source) {
+			stop += 1
+			continue
+		}
+		if ch == '(' {
+			depth += 1
+		}
+		if ch == ')' {
+			if depth == 0 {
+				break
+			}
+			depth -= 1
+		}
+		if util.IsSpace(ch) {
+			break
+		}
+	}
+
+	c.add(kind, string(dest), pos, stop)
+}
+
+var definitionRe = regexp.MustCompile(`(?m)^[ \t]*\[(?:[^\[\]\\]|\\.)+\]:[ \t]*\n?[ \t]*(?:<([^<>\n]*)>|(\S+))`)
+
+// definitions records destinations of link reference definitions in paragraph lines,
+// matched without prefixes of containing blocks, e.g. `>` of block quotes
+func (c *collector) definitions(lines []text.Segment) {
+	joined := make([]byte, 0)
+	starts := make([]int, 0, len(lines)) // of the lines in joined content
+
+	for _, l := range lines {
+		starts = append(starts, len(joined))
+		joined = append(joined, c.source[l.Start:l.Stop]...)
+	}
+
+	for _, m := range definitionRe.FindAllSubmatchIndex(joined, -1) {
+		s, e := m[2], m[3]
+		if s < 0 {
+			s, e = m[4], m[5]
+		}
+
+		// Destination doesn't span lines
+		line, found := slices.BinarySearch(starts, s)
+		if !found {
+			line -= 1
+		}
+		offset := lines[line].Start - starts[line]
+
+		dest := util.UnescapePunctuations(joined[s:e])
+		c.add(REF_DEFINITION, string(dest), offset+s, offset+e)
+	}
+}
+
+var (
+	htmlTagRe  = regexp.MustCompile(`(?i)<(?:img|video|audio|source|track|a)\b[^>]*`)
+	htmlAttrRe = regexp.MustCompile("(?i)\\s(?:src|href|poster)\\s*=\\s*(?:\"([^\"]*)\"|'([^']*)'|([^\\s\"'=<>`]+))")
+)
+
+// html records url attributes of html tags in the source range
+func (c *collector) html(start, stop int) {
+	for _, tag := range htmlTagRe.FindAllIndex(c.source[start:stop], -1) {
+		tagStart := start + tag[0]
+
+		for _, m := range htmlAttrRe.FindAllSubmatchIndex(c.source[tagStart:start+tag[1]], -1) {
+			for g := 2; g < len(m); g += 2 {
+				if m[g] < 0 {
+					continue
+				}
+
+				dest := html.UnescapeString(string(c.source[tagStart+m[g] : tagStart+m[g+1]]))
+				c.add(REF_HTML, dest, tagStart+m[g], tagStart+m[g+1])
+			}
+		}
+	}
+}
+
+func (c *collector) add(kind RefKind, dest string, start, stop int) {
+	if start >= stop {
+		return
+	}
+
+	c.refs = append(c.refs, Ref{kind, dest, start, stop})
+}
+
+func skipSpaces(source []byte, pos int) int {
+	for pos < len(source) && util.IsSpace(source[pos]) {
+		pos += 1
+	}
+	return pos
+}
+
+// linkPositions wraps goldmark's link parser to record positions of inline
+// destinations, which are not preserved in the parsed tree
+type linkPositions struct {
+	parser.InlineParser
+	c *collector
+}
+
+func (p linkPositions) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	node := p.InlineParser.Parse(parent, block, pc)
+
+	if node == nil || len(line) < 2 || line[0] != ']' || line[1] != '(' {
+		return node
+	}
+
+	// Reader is moved back right after `]` if `(...)` turns out not to be
+	// a destination and the link is a shortcut reference instead
+	if _, pos := block.Position(); pos.Start > segment.Start+1 {
+		p.c.inline(node, segment.Start)
+	}
+
+	return node
+}
+
+func (p linkPositions) CloseBlock(parent ast.Node, block text.Reader, pc parser.Context) {
+	if cb, ok := p.InlineParser.(parser.CloseBlocker); ok {
+		cb.CloseBlock(parent, block, pc)
+	}
+}
+
+// definitionPositions wraps goldmark's transformer extracting link reference
+// definitions from paragraphs to record positions of their destinations
+type definitionPositions struct {
+	parser.ParagraphTransformer
+	c *collector
+}
+
+func (t definitionPositions) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	lines := node.Lines()
+	// Transformer modifies lines in place
+	before := slices.Clone(lines.Sliced(0, lines.Len()))
+
+	t.ParagraphTransformer.Transform(node, reader, pc)
+
+	// Paragraph consisting only of definitions is replaced
+	kept := map[int]bool{}
+	if node.Parent() != nil {
+		for idx := range node.Lines().Len() {
+			kept[node.Lines().At(idx).Start] = true
+		}
+	}
+
+	for idx := 0; idx < len(before); {
+		if kept[before[idx].Start] {
+			idx += 1
+			continue
+		}
+
+		first := idx
+		for idx < len(before) && !kept[before[idx].Start] {
+			idx += 1
+		}
+
+		t.c.definitions(before[first:idx])
+	}
+}
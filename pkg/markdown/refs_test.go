@@ -0,0 +1,71 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRefs(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{
+			"![a](a.png) and ![b](b.png)",
+			"![a]({a.png}) and ![b]({b.png})",
+		},
+		{
+			`![a](a.png "title") ![](<b c.png> 'title')`,
+			`![a]({a.png} "title") ![](<{b c.png}> 'title')`,
+		},
+		{
+			"[pdf](./docs/a.pdf) [nested [label]](a\\(1\\).pdf) ![x](a_(1).png)",
+			"[pdf]({./docs/a.pdf}) [nested [label]]({a(1).pdf}) ![x]({a_(1).png})",
+		},
+		{
+			"![a][ref] [b]\n\n[ref]: a.png\n[b]:\n  <b.pdf> \"title\"\n",
+			"![a][ref] [b]\n\n[ref]: {a.png}\n[b]:\n  <{b.pdf}> \"title\"\n",
+		},
+		{
+			"text <img alt=\"a\" src=\"a.png\"> text\n\n<video poster='p.png'>\n  <source src=b.mp4>\n</video>\n",
+			"text <img alt=\"a\" src=\"{a.png}\"> text\n\n<video poster='{p.png}'>\n  <source src={b.mp4}>\n</video>\n",
+		},
+		{
+			"`![a](a.png)`\n\n```\n![b](b.png)\n```\n\n[not a link](a.png",
+			"`![a](a.png)`\n\n```\n![b](b.png)\n```\n\n[not a link](a.png",
+		},
+		{
+			"[ref](x.png)\n\n[ref]: a.png\n",
+			"[ref]({x.png})\n\n[ref]: {a.png}\n",
+		},
+		{
+			"![a][a] ![b][b]\n\n> [a]: a.png\n> [b]: b.png\n>\n> - [c]:\n>   c.png\n",
+			"![a][a] ![b][b]\n\n> [a]: {a.png}\n> [b]: {b.png}\n>\n> - [c]:\n>   {c.png}\n",
+		},
+	}
+
+	for idx, test := range tests {
+		source := []byte(test.source)
+		result := string(Rewrite(source, Refs(source), func(ref Ref) (string, bool) {
+			return "{" + ref.Dest + "}", true
+		}))
+
+		if result != test.expected {
+			t.Errorf("%v) Rewrite(%q): expected\n%v\nbut got\n%v", idx, test.source, test.expected, result)
+		}
+	}
+}
+
+func TestRefsKinds(t *testing.T) {
+	source := "![a](a.png) [b](b.pdf) [c]\n\n<img src=\"d.png\">\n\n[c]: c.svg\n"
+
+	kinds := make([]string, 0)
+	for _, ref := range Refs([]byte(source)) {
+		kinds = append(kinds, string(ref.Kind)+":"+ref.Dest)
+	}
+
+	expected := "image:a.png link:b.pdf html:d.png definition:c.svg"
+	if result := strings.Join(kinds, " "); result != expected {
+		t.Errorf("Refs(%q): expected %v but got %v", source, expected, result)
+	}
+}
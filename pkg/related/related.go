@@ -0,0 +1,177 @@
+package related
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type Document struct {
+	Id   string
+	Tags []string
+	Text string
+}
+
+type Params struct {
+	Count         int
+	TagsWeight    float64
+	ContentWeight float64
+	MinScore      float64
+}
+
+// Find returns ids of up to `params.Count` most similar documents for each document.
+// Similarity is a weighted sum of tags overlap (Jaccard index) and cosine similarity
+// of TF-IDF vectors built from document texts.
+func Find(docs []Document, params Params) map[string][]string {
+	result := make(map[string][]string, len(docs))
+
+	if params.Count <= 0 {
+		return result
+	}
+
+	vectors := tfIdf(docs)
+
+	for i, a := range docs {
+		type candidate struct {
+			id    string
+			score float64
+		}
+
+		candidates := make([]candidate, 0)
+
+		for j, b := range docs {
+			if i == j {
+				continue
+			}
+
+			score := params.TagsWeight*jaccard(a.Tags, b.Tags) + params.ContentWeight*cosine(vectors[i], vectors[j])
+
+			if score <= params.MinScore {
+				continue
+			}
+
+			candidates = append(candidates, candidate{b.Id, score})
+		}
+
+		slices.SortFunc(candidates, func(x, y candidate) int {
+			if x.score == y.score {
+				return strings.Compare(x.id, y.id)
+			}
+			if x.score > y.score {
+				return -1
+			}
+			return 1
+		})
+
+		ids := make([]string, 0, params.Count)
+		for _, c := range candidates[:min(params.Count, len(candidates))] {
+			ids = append(ids, c.id)
+		}
+
+		result[a.Id] = ids
+	}
+
+	return result
+}
+
+type vector = map[string]float64
+
+func tfIdf(docs []Document) []vector {
+	terms := make([]map[string]int, len(docs))
+	df := make(map[string]int)
+
+	for i, d := range docs {
+		terms[i] = make(map[string]int)
+
+		for _, t := range tokenize(d.Text) {
+			if terms[i][t] == 0 {
+				df[t] += 1
+			}
+			terms[i][t] += 1
+		}
+	}
+
+	vectors := make([]vector, len(docs))
+
+	for i, tf := range terms {
+		vectors[i] = make(vector, len(tf))
+
+		for t, count := range tf {
+			idf := math.Log(float64(len(docs)) / float64(df[t]))
+			vectors[i][t] = float64(count) * idf
+		}
+	}
+
+	return vectors
+}
+
+func cosine(a, b vector) float64 {
+	var dot, normA, normB float64
+
+	for t, v := range a {
+		dot += v * b[t]
+		normA += v * v
+	}
+
+	for _, v := range b {
+		normB += v * v
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	set := make(map[string]bool)
+	for _, t := range a {
+		set[strings.ToLower(t)] = true
+	}
+
+	common := 0
+	union := len(set)
+	for _, t := range b {
+		t = strings.ToLower(t)
+		if set[t] {
+			common += 1
+			set[t] = false
+		} else if _, seen := set[t]; !seen {
+			union += 1
+			set[t] = false
+		}
+	}
+
+	return float64(common) / float64(union)
+}
+
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true,
+	"you": true, "all": true, "can": true, "was": true, "one": true, "our": true,
+	"has": true, "have": true, "this": true, "that": true, "with": true, "from": true,
+	"they": true, "will": true, "would": true, "there": true, "their": true, "what": true,
+	"about": true, "which": true, "when": true, "your": true, "into": true, "than": true,
+	"then": true, "them": true, "these": true, "some": true, "also": true, "just": true,
+}
+
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if len([]rune(w)) < 3 || stopWords[w] {
+			continue
+		}
+		tokens = append(tokens, w)
+	}
+
+	return tokens
+}
@@ -0,0 +1,50 @@
+package related
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	docs := []Document{
+		{"go-errors", []string{"go"}, "Handling errors in golang with wrapping and sentinel errors"},
+		{"go-generics", []string{"go"}, "Generics in golang: type parameters and constraints"},
+		{"rust-errors", []string{"rust"}, "Handling errors in rust with result and question mark"},
+		{"cooking", []string{}, "Baking sourdough bread at home"},
+	}
+
+	tests := []struct {
+		params   Params
+		expected map[string][]string
+	}{
+		{
+			Params{Count: 1, TagsWeight: 1, ContentWeight: 1},
+			map[string][]string{
+				"go-errors":   {"go-generics"},
+				"go-generics": {"go-errors"},
+				"rust-errors": {"go-errors"},
+				"cooking":     {},
+			},
+		},
+		{
+			Params{Count: 3, TagsWeight: 0, ContentWeight: 1},
+			map[string][]string{
+				"go-errors":   {"rust-errors", "go-generics"},
+				"go-generics": {"go-errors"},
+				"rust-errors": {"go-errors"},
+				"cooking":     {},
+			},
+		},
+		{
+			Params{Count: 0, TagsWeight: 1, ContentWeight: 1},
+			map[string][]string{},
+		},
+	}
+
+	for idx, test := range tests {
+		result := Find(docs, test.params)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%v) Find(%v): expected '%v' but got '%v'", idx, test.params, test.expected, result)
+		}
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"embed"
 	"html/template"
 	"io"
+	"net/url"
 	"time"
 
 	"github.com/mtratsiuk/b3/pkg/config"
+	"github.com/mtratsiuk/b3/pkg/feed"
 )
 
 //go:embed *.html
@@ -19,9 +21,13 @@ var baseCss template.CSS
 var baseJs template.JS
 
 type Templates struct {
-	config config.Config
-	post   *template.Template
-	home   *template.Template
+	config  config.Config
+	feedUrl string
+	post    *template.Template
+	home    *template.Template
+	list    *template.Template
+	page    *template.Template
+	history *template.Template
 }
 
 func New(cfg config.Config) (Templates, error) {
@@ -35,60 +41,171 @@ func New(cfg config.Config) (Templates, error) {
 		return Templates{}, err
 	}
 
-	t := Templates{cfg, post, home}
+	list, err := template.ParseFS(viewsFs, "base.html", "components.html", "list.html")
+	if err != nil {
+		return Templates{}, err
+	}
+
+	page, err := template.ParseFS(viewsFs, "base.html", "components.html", "page.html")
+	if err != nil {
+		return Templates{}, err
+	}
+
+	history, err := template.ParseFS(viewsFs, "base.html", "components.html", "history.html")
+	if err != nil {
+		return Templates{}, err
+	}
+
+	feedUrl := ""
+	if cfg.HomeLink != "" {
+		feedUrl, err = url.JoinPath(cfg.HomeLink, feed.FILE_NAME)
+		if err != nil {
+			return Templates{}, err
+		}
+	}
+
+	t := Templates{cfg, feedUrl, post, home, list, page, history}
 	return t, nil
 }
 
+// WithConfig returns templates rendered with updated config, e.g. with resolved header links
+func (t Templates) WithConfig(cfg config.Config) Templates {
+	t.config = cfg
+	return t
+}
+
 type BaseData[T any] struct {
 	Title       string
 	Description string
 	Css         template.CSS
 	Js          template.JS
 	Config      config.Config
+	FeedUrl     string
 	PageData    T
 }
 
+func render[T any](t Templates, tmpl *template.Template, wr io.Writer, name string, title string, description string, data T) error {
+	return tmpl.ExecuteTemplate(wr, name, BaseData[T]{
+		Title:       title,
+		Description: description,
+		Css:         baseCss,
+		Js:          baseJs,
+		Config:      t.config,
+		FeedUrl:     t.feedUrl,
+		PageData:    data,
+	})
+}
+
 type PostData struct {
 	Title       string
 	Description string
 	PostHtml    template.HTML
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	Unpublished bool
+	HistoryUrl  string
+	Author      *AuthorData
+	Related     []RelatedPostData
+}
+
+type AuthorData struct {
+	Id      string
+	Name    string
+	Avatar  string
+	Url     string
+	PageUrl string // url of author's posts listing, empty for authors not listed in config
+}
+
+type RelatedPostData struct {
+	Id        string
+	Url       string
+	Title     template.HTML
+	CreatedAt time.Time
 }
 
 func (t Templates) RenderPost(wr io.Writer, data PostData) error {
-	return t.post.ExecuteTemplate(wr, "post.html", BaseData[PostData]{
-		Title:       data.Title,
-		Description: data.Description,
-		Css:         baseCss,
-		Js:          baseJs,
-		Config:      t.config,
-		PageData:    data,
-	})
+	return render(t, t.post, wr, "post.html", data.Title, data.Description, data)
 }
 
 type HomeData struct {
 	Title       string
 	Description string
+	IntroHtml   template.HTML
+	Featured    []HomePostData
 	Posts       []HomePostData
+	Sections    []HomeSectionData
+}
+
+type HomeSectionData struct {
+	Name  string
+	Title string
+	Url   string
+	Posts []HomePostData
 }
 
 type HomePostData struct {
 	Id          string
+	Collection  string
 	Url         string
 	Title       template.HTML
 	Description template.HTML
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	Unpublished bool
+	HistoryUrl  string
+	Featured    bool
 }
 
 func (t Templates) RenderHome(wr io.Writer, data HomeData) error {
-	return t.home.ExecuteTemplate(wr, "home.html", BaseData[HomeData]{
-		Title:       data.Title,
-		Description: data.Description,
-		Css:         baseCss,
-		Js:          baseJs,
-		Config:      t.config,
-		PageData:    data,
-	})
+	return render(t, t.home, wr, "home.html", data.Title, data.Description, data)
+}
+
+type ListData struct {
+	Title       string
+	Description string
+	Author      *AuthorData // set for author's posts listing
+	FeedUrl     string
+	Posts       []HomePostData
+}
+
+func (t Templates) RenderList(wr io.Writer, data ListData) error {
+	return render(t, t.list, wr, "list.html", data.Title, data.Description, data)
+}
+
+type PageData struct {
+	Title       string
+	Description string
+	PageHtml    template.HTML
+}
+
+func (t Templates) RenderPage(wr io.Writer, data PageData) error {
+	return render(t, t.page, wr, "page.html", data.Title, data.Description, data)
+}
+
+type HistoryData struct {
+	Title       string
+	Description string
+	PostTitle   template.HTML
+	PostUrl     string
+	Revisions   []RevisionData
+}
+
+type RevisionData struct {
+	Hash       string
+	AuthorName string
+	Date       time.Time
+	Message    string
+	Diff       []DiffData
+}
+
+// DiffData is a chunk of word-level diff of post's markdown with its previous revision
+type DiffData struct {
+	Text     string
+	Inserted bool
+	Deleted  bool
+	Skipped  bool // unchanged lines omitted from the diff
+}
+
+func (t Templates) RenderHistory(wr io.Writer, data HistoryData) error {
+	return render(t, t.history, wr, "history.html", data.Title, data.Description, data)
 }
@@ -0,0 +1,100 @@
+package timestamper
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ChainTimestamper returns the first non-zero timestamp of the given timestampers.
+// Shallow clone error stops the chain, as falling back would silently produce wrong timestamps
+type ChainTimestamper struct {
+	timestampers []Timestamper
+}
+
+func NewChain(timestampers ...Timestamper) ChainTimestamper {
+	return ChainTimestamper{timestampers}
+}
+
+func (ct ChainTimestamper) CreatedAt(filepath string) (time.Time, error) {
+	return ct.first(func(t Timestamper) (time.Time, error) {
+		return t.CreatedAt(filepath)
+	})
+}
+
+func (ct ChainTimestamper) UpdatedAt(filepath string) (time.Time, error) {
+	return ct.first(func(t Timestamper) (time.Time, error) {
+		return t.UpdatedAt(filepath)
+	})
+}
+
+// Uncommitted reports whether any of the timestampers tracking changes
+// considers the file uncommitted
+func (ct ChainTimestamper) Uncommitted(filepath string) (bool, error) {
+	for _, t := range ct.timestampers {
+		if tracker, ok := t.(Tracker); ok {
+			uncommitted, err := tracker.Uncommitted(filepath)
+			if err == nil && uncommitted {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Revisions returns revisions of the file read by the first timestamper able to do it
+func (ct ChainTimestamper) Revisions(filepath string) ([]Revision, error) {
+	for _, t := range ct.timestampers {
+		if historian, ok := t.(Historian); ok {
+			return historian.Revisions(filepath)
+		}
+	}
+
+	return nil, ErrNoHistory
+}
+
+// Author returns author of the file told by the first timestamper able to do it
+func (ct ChainTimestamper) Author(filepath string) (Author, error) {
+	errs := make([]error, 0)
+
+	for _, t := range ct.timestampers {
+		if attributor, ok := t.(Attributor); ok {
+			author, err := attributor.Author(filepath)
+			if err == nil && author != (Author{}) {
+				return author, nil
+			}
+			if err != nil && !errors.Is(err, ErrNoTimestamp) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return Author{}, errors.Join(errs...)
+	}
+
+	return Author{}, ErrNoTimestamp
+}
+
+func (ct ChainTimestamper) first(get func(t Timestamper) (time.Time, error)) (time.Time, error) {
+	errs := make([]error, 0)
+
+	for _, t := range ct.timestampers {
+		ts, err := get(t)
+
+		if err == nil && !ts.IsZero() {
+			return ts, nil
+		}
+
+		if errors.Is(err, ErrShallowClone) {
+			return time.Time{}, fmt.Errorf("%T: %w", t, err)
+		}
+
+		if err != nil && !errors.Is(err, ErrNoTimestamp) {
+			errs = append(errs, fmt.Errorf("%T: %v", t, err))
+		}
+	}
+
+	return time.Time{}, errors.Join(append([]error{ErrNoTimestamp}, errs...)...)
+}
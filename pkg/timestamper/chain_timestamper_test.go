@@ -0,0 +1,55 @@
+package timestamper
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type stubTimestamper struct {
+	ts  time.Time
+	err error
+}
+
+func (st stubTimestamper) CreatedAt(filepath string) (time.Time, error) {
+	return st.ts, st.err
+}
+
+func (st stubTimestamper) UpdatedAt(filepath string) (time.Time, error) {
+	return st.ts, st.err
+}
+
+func TestChainTimestamper(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	failed := stubTimestamper{time.Time{}, errors.New("failed")}
+	missing := stubTimestamper{time.Time{}, ErrNoTimestamp}
+	zero := stubTimestamper{time.Time{}, nil}
+	ok := stubTimestamper{ts, nil}
+	shallow := stubTimestamper{time.Time{}, fmt.Errorf("%w: /repo", ErrShallowClone)}
+
+	tests := []struct {
+		chain    ChainTimestamper
+		expected time.Time
+		err      error
+	}{
+		{NewChain(ok), ts, nil},
+		{NewChain(failed, missing, zero, ok), ts, nil},
+		{NewChain(missing, zero), time.Time{}, ErrNoTimestamp},
+		{NewChain(), time.Time{}, ErrNoTimestamp},
+		{NewChain(missing, shallow, ok), time.Time{}, ErrShallowClone},
+	}
+
+	for idx, test := range tests {
+		result, err := test.chain.CreatedAt("post.md")
+		if (err != nil) != (test.err != nil) {
+			t.Errorf("%v) CreatedAt: unexpected error: %v", idx, err)
+		}
+		if err != nil && !errors.Is(err, test.err) {
+			t.Errorf("%v) CreatedAt: expected '%v' but got '%v'", idx, test.err, err)
+		}
+		if !result.Equal(test.expected) {
+			t.Errorf("%v) CreatedAt: expected '%v' but got '%v'", idx, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package timestamper
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mtratsiuk/b3/pkg/utils"
+)
+
+// FrontMatterTimestamper reads explicit `created_at` and `updated_at` dates from post's front matter.
+// Missing `updated_at` defaults to `created_at`
+type FrontMatterTimestamper struct {
+	readFile func(path string) ([]byte, error)
+}
+
+// NewFrontMatter creates timestamper reading files with `readFile`, or from the working tree if it's nil
+func NewFrontMatter(readFile func(path string) ([]byte, error)) FrontMatterTimestamper {
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+
+	return FrontMatterTimestamper{readFile}
+}
+
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func (ft FrontMatterTimestamper) CreatedAt(filepath string) (time.Time, error) {
+	return ft.readDate(filepath, "created_at")
+}
+
+func (ft FrontMatterTimestamper) UpdatedAt(filepath string) (time.Time, error) {
+	updatedAt, err := ft.readDate(filepath, "updated_at")
+	if err == ErrNoTimestamp {
+		return ft.readDate(filepath, "created_at")
+	}
+
+	return updatedAt, err
+}
+
+func (ft FrontMatterTimestamper) readDate(filepath string, key string) (time.Time, error) {
+	content, err := ft.readFile(filepath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	fm, _, err := utils.ParseFrontMatter(content)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	value := fm.String(key)
+	if value == "" {
+		return time.Time{}, ErrNoTimestamp
+	}
+
+	for _, layout := range frontMatterDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("failed to parse `%v` date: %v", key, value)
+}
@@ -0,0 +1,32 @@
+package timestamper
+
+import (
+	"os"
+	"time"
+)
+
+// FsTimestamper uses file's modification time for both created and updated timestamps,
+// since file creation time is not portable across file systems
+type FsTimestamper struct {
+}
+
+func NewFs() FsTimestamper {
+	return FsTimestamper{}
+}
+
+func (ft FsTimestamper) CreatedAt(filepath string) (time.Time, error) {
+	return modTime(filepath)
+}
+
+func (ft FsTimestamper) UpdatedAt(filepath string) (time.Time, error) {
+	return modTime(filepath)
+}
+
+func modTime(filepath string) (time.Time, error) {
+	stat, err := os.Stat(filepath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return stat.ModTime(), nil
+}
@@ -1,45 +1,403 @@
 package timestamper
 
 import (
-	"os/exec"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/mtratsiuk/b3/pkg/diff"
+	"github.com/mtratsiuk/b3/pkg/git"
 )
 
+// GitTimestamper reads timestamps from the history of git repository containing the file.
+// History of all files is read once with a single `git log` invocation, or directly
+// from `.git` directory if `git` executable is not available
 type GitTimestamper struct {
+	options GitOptions
+	now     time.Time
+	repos   *gitRepos
+}
+
+const (
+	UNCOMMITTED_MTIME = "mtime"
+	UNCOMMITTED_NOW   = "now"
+
+	SHALLOW_FAIL   = "fail"
+	SHALLOW_DEEPEN = "deepen"
+	SHALLOW_IGNORE = "ignore"
+)
+
+type GitOptions struct {
+	// Timestamp of files without commits, and update timestamp of files
+	// with uncommitted changes: `mtime` (default) or `now`
+	UncommittedTimestamp string
+	// Handling of shallow clones, which have truncated history: `fail` (default),
+	// `deepen` to fetch the missing history, or `ignore`
+	ShallowClone string
+	// Commit to read history from instead of HEAD. Files are never
+	// considered uncommitted if it's set
+	Ref string
+	// Commits with message containing any of these strings don't update the timestamp
+	IgnoreMessages []string
+	// Commits of these authors (names or emails) don't update the timestamp
+	IgnoreAuthors []string
+	// Commits changing fewer lines of the file don't update the timestamp
+	MinChangedLines int
+}
+
+type gitRepos struct {
+	mu        sync.Mutex
+	toplevels map[string]string
+	repos     map[string]git.Repo
+	histories map[string]*git.History
 }
 
-func NewGit() GitTimestamper {
-	return GitTimestamper{}
+func NewGit(options GitOptions) (GitTimestamper, error) {
+	switch options.UncommittedTimestamp {
+	case "":
+		options.UncommittedTimestamp = UNCOMMITTED_MTIME
+	case UNCOMMITTED_MTIME, UNCOMMITTED_NOW:
+	default:
+		return GitTimestamper{}, fmt.Errorf("timestamper.NewGit: unexpected uncommitted timestamp: %v", options.UncommittedTimestamp)
+	}
+
+	switch options.ShallowClone {
+	case "":
+		options.ShallowClone = SHALLOW_FAIL
+	case SHALLOW_FAIL, SHALLOW_DEEPEN, SHALLOW_IGNORE:
+	default:
+		return GitTimestamper{}, fmt.Errorf("timestamper.NewGit: unexpected shallow clone handling: %v", options.ShallowClone)
+	}
+
+	return GitTimestamper{options, time.Now(), &gitRepos{
+		toplevels: make(map[string]string),
+		repos:     make(map[string]git.Repo),
+		histories: make(map[string]*git.History),
+	}}, nil
 }
 
 func (gt GitTimestamper) CreatedAt(filepath string) (time.Time, error) {
-	log, err := getGitLogDates(filepath)
+	log, err := gt.FileLog(filepath)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	return time.Parse(time.RFC3339, log[len(log)-1])
+	if len(log) == 0 {
+		return gt.uncommittedTime(filepath)
+	}
+
+	return log[len(log)-1].Commit.AuthorDate, nil
 }
 
 func (gt GitTimestamper) UpdatedAt(filepath string) (time.Time, error) {
-	log, err := getGitLogDates(filepath)
+	repo, rel, history, err := gt.lookup(filepath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	log := history.FileLog(rel)
+	if len(log) == 0 {
+		return gt.uncommittedTime(filepath)
+	}
+
+	modified, err := gt.repoModified(repo, rel)
 	if err != nil {
 		return time.Time{}, err
 	}
 
-	return time.Parse(time.RFC3339, log[0])
+	if modified {
+		return gt.uncommittedTime(filepath)
+	}
+
+	// The oldest commit created the file, so it's never trivial
+	for _, fc := range log[:len(log)-1] {
+		trivial, err := gt.trivial(repo, fc)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if !trivial {
+			return fc.Commit.AuthorDate, nil
+		}
+	}
+
+	return log[len(log)-1].Commit.AuthorDate, nil
+}
+
+// trivial reports whether the commit is ignored by the options,
+// e.g. a typo fix or an automated cdn links rewrite
+func (gt GitTimestamper) trivial(repo git.Repo, fc git.FileCommit) (bool, error) {
+	for _, m := range gt.options.IgnoreMessages {
+		if strings.Contains(fc.Commit.Message, m) {
+			return true, nil
+		}
+	}
+
+	for _, a := range gt.options.IgnoreAuthors {
+		if a == fc.Commit.AuthorName || strings.EqualFold(a, fc.Commit.AuthorEmail) {
+			return true, nil
+		}
+	}
+
+	if gt.options.MinChangedLines <= 0 {
+		return false, nil
+	}
+
+	changed, err := changedLines(repo, fc.Change)
+	if err != nil {
+		return false, err
+	}
+
+	return changed < gt.options.MinChangedLines, nil
+}
+
+func changedLines(repo git.Repo, ch git.Change) (int, error) {
+	if ch.OldBlob == ch.NewBlob {
+		return 0, nil
+	}
+
+	old, err := repo.ReadBlob(ch.OldBlob)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read blob: %v", err)
+	}
+
+	new, err := repo.ReadBlob(ch.NewBlob)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read blob: %v", err)
+	}
+
+	// Edited line counts both as deleted and inserted
+	inserted, deleted := diff.Stat(diff.Diff(diff.Lines(string(old)), diff.Lines(string(new))))
+
+	return max(inserted, deleted), nil
+}
+
+// Uncommitted reports whether the file is not committed yet or has uncommitted changes
+func (gt GitTimestamper) Uncommitted(filepath string) (bool, error) {
+	log, err := gt.FileLog(filepath)
+	if err != nil {
+		return false, err
+	}
+
+	if len(log) == 0 {
+		return true, nil
+	}
+
+	return gt.modified(filepath)
 }
 
-func getGitLogDates(filepath string) ([]string, error) {
-	cmd := exec.Command("git", "log", "--follow", "--format=%ad", "--date=iso8601-strict", filepath)
+// Author returns author of the commit which added the file. Files outside
+// of git repositories have no author
+func (gt GitTimestamper) Author(filepath string) (Author, error) {
+	log, err := gt.FileLog(filepath)
+	if errors.Is(err, git.ErrNotRepository) {
+		return Author{}, ErrNoTimestamp
+	}
+	if err != nil {
+		return Author{}, err
+	}
+
+	if len(log) == 0 {
+		return Author{}, ErrNoTimestamp
+	}
+
+	first := log[len(log)-1].Commit
 
-	var out strings.Builder
-	cmd.Stdout = &out
+	return Author{first.AuthorName, first.AuthorEmail}, nil
+}
+
+// Revisions returns committed revisions of the file, newest first. Files outside
+// of git repositories have no history
+func (gt GitTimestamper) Revisions(filepath string) ([]Revision, error) {
+	repo, rel, history, err := gt.lookup(filepath)
+	if errors.Is(err, git.ErrNotRepository) {
+		return nil, ErrNoHistory
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log := history.FileLog(rel)
+	revisions := make([]Revision, 0, len(log))
+
+	for _, fc := range log {
+		content, err := repo.ReadBlob(fc.Change.NewBlob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob: %v", err)
+		}
+
+		revisions = append(revisions, Revision{
+			Hash:        fc.Commit.Hash,
+			AuthorName:  fc.Commit.AuthorName,
+			AuthorEmail: fc.Commit.AuthorEmail,
+			Date:        fc.Commit.AuthorDate,
+			Message:     fc.Commit.Message,
+			Content:     content,
+		})
+	}
+
+	return revisions, nil
+}
+
+// FileLog returns commits changing the file, newest first
+func (gt GitTimestamper) FileLog(path string) ([]git.FileCommit, error) {
+	_, rel, history, err := gt.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return history.FileLog(rel), nil
+}
+
+func (gt GitTimestamper) modified(path string) (bool, error) {
+	repo, rel, _, err := gt.lookup(path)
+	if err != nil {
+		return false, err
+	}
+
+	return gt.repoModified(repo, rel)
+}
+
+func (gt GitTimestamper) repoModified(repo git.Repo, rel string) (bool, error) {
+	if gt.options.Ref != "" {
+		return false, nil
+	}
+
+	return repo.Modified(rel)
+}
+
+func (gt GitTimestamper) uncommittedTime(path string) (time.Time, error) {
+	if gt.options.UncommittedTimestamp == UNCOMMITTED_NOW {
+		return gt.now, nil
+	}
+
+	return modTime(path)
+}
+
+// lookup returns repository containing the file, file's path relative
+// to the repository's root and the repository's history
+func (gt GitTimestamper) lookup(path string) (git.Repo, string, *git.History, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	dir := filepath.Dir(abs)
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+
+	repo, toplevel, history, err := gt.repos.history(dir, gt.options)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	rel, err := filepath.Rel(toplevel, filepath.Join(dir, filepath.Base(abs)))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return repo, filepath.ToSlash(rel), history, nil
+}
+
+func (r *gitRepos) history(dir string, options GitOptions) (git.Repo, string, *git.History, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	toplevel, ok := r.toplevels[dir]
+	if !ok {
+		// Files read from a ref may not exist in the working tree
+		repo, err := git.Open(existingDir(dir))
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to open git repository: %w", err)
+		}
+
+		tl, err := repo.Toplevel()
+		if err != nil {
+			repo.Close()
+			return nil, "", nil, fmt.Errorf("failed to find git repository: %w", err)
+		}
+
+		// Resolve symlinks so that relative paths of files are computed correctly
+		if resolved, err := filepath.EvalSymlinks(tl); err == nil {
+			tl = resolved
+		}
+
+		toplevel = tl
+		r.toplevels[dir] = toplevel
+
+		// Directories of the same repository share the first opened one
+		if _, ok := r.repos[toplevel]; ok {
+			repo.Close()
+		} else {
+			r.repos[toplevel] = repo
+		}
+	}
+
+	repo := r.repos[toplevel]
+
+	history, ok := r.histories[toplevel]
+	if !ok {
+		if err := checkShallow(repo, toplevel, options.ShallowClone); err != nil {
+			return nil, "", nil, err
+		}
+
+		h, err := git.LoadHistory(repo, options.Ref)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		history = h
+		r.histories[toplevel] = history
+	}
+
+	return repo, toplevel, history, nil
+}
+
+// existingDir returns the closest existing ancestor of `dir`
+func existingDir(dir string) string {
+	for {
+		if stat, err := os.Stat(dir); err == nil && stat.IsDir() {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+func checkShallow(repo git.Repo, toplevel string, shallowClone string) error {
+	if shallowClone == SHALLOW_IGNORE {
+		return nil
+	}
+
+	shallow, err := repo.IsShallow()
+	if err != nil {
+		return fmt.Errorf("failed to check if repository is shallow: %v", err)
+	}
+
+	if !shallow {
+		return nil
+	}
 
-	if err := cmd.Run(); err != nil {
-		return []string{}, err
+	if shallowClone == SHALLOW_DEEPEN {
+		if err := repo.Unshallow(); err != nil {
+			return fmt.Errorf("failed to fetch full history of shallow clone %v: %v", toplevel, err)
+		}
+		return nil
 	}
 
-	return strings.Split(strings.TrimSpace(out.String()), "\n"), nil
+	return fmt.Errorf(
+		"%w: %v, post timestamps can't be computed from truncated history: "+
+			"fetch full history (e.g. `fetch-depth: 0` for actions/checkout), "+
+			"or set `git.shallow_clone` to `deepen` or `ignore` in b3.json",
+		ErrShallowClone, toplevel,
+	)
 }
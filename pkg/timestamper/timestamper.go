@@ -1,8 +1,86 @@
 package timestamper
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 type Timestamper interface {
 	CreatedAt(filepath string) (time.Time, error)
 	UpdatedAt(filepath string) (time.Time, error)
 }
+
+// Tracker is implemented by timestampers aware of files' uncommitted changes
+type Tracker interface {
+	Uncommitted(filepath string) (bool, error)
+}
+
+// Historian is implemented by timestampers able to read previous revisions of files
+type Historian interface {
+	Revisions(filepath string) ([]Revision, error)
+}
+
+// Attributor is implemented by timestampers able to tell who created a file
+type Attributor interface {
+	Author(filepath string) (Author, error)
+}
+
+type Author struct {
+	Name  string
+	Email string
+}
+
+type Revision struct {
+	Hash        string
+	AuthorName  string
+	AuthorEmail string
+	Date        time.Time
+	Message     string
+	Content     []byte
+}
+
+var ErrNoTimestamp = errors.New("timestamp is not available")
+var ErrNoHistory = errors.New("history is not available")
+
+// ErrShallowClone is returned for files of shallow clones, which timestamps
+// can't be computed from. Unlike other errors it's not recovered from by falling
+// back to the next timestamper of the chain
+var ErrShallowClone = errors.New("repository is a shallow clone")
+
+const (
+	FRONT_MATTER = "front_matter"
+	GIT          = "git"
+	FS           = "fs"
+)
+
+type Options struct {
+	Git GitOptions
+	// Reads posts' content, defaults to reading from the working tree
+	ReadFile func(path string) ([]byte, error)
+}
+
+// New creates chain of timestamp sources by names,
+// e.g. ["front_matter", "git", "fs"]
+func New(sources []string, options Options) (Timestamper, error) {
+	timestampers := make([]Timestamper, 0, len(sources))
+
+	for _, s := range sources {
+		switch s {
+		case FRONT_MATTER:
+			timestampers = append(timestampers, NewFrontMatter(options.ReadFile))
+		case GIT:
+			gt, err := NewGit(options.Git)
+			if err != nil {
+				return nil, err
+			}
+			timestampers = append(timestampers, gt)
+		case FS:
+			timestampers = append(timestampers, NewFs())
+		default:
+			return nil, fmt.Errorf("timestamper.New: unexpected timestamper: %v", s)
+		}
+	}
+
+	return NewChain(timestampers...), nil
+}
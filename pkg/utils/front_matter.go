@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const frontMatterDelimiter = "---"
+
+// FrontMatter holds `key: value` pairs from the block delimited by `---` lines
+// at the very beginning of a markdown file. Values are either strings or
+// string lists (`key: [a, b]` or `- item` lines following `key:`).
+type FrontMatter map[string]any
+
+func ParseFrontMatter(content []byte) (FrontMatter, []byte, error) {
+	fm := FrontMatter{}
+
+	rest, ok := cutLine(content, frontMatterDelimiter)
+	if !ok {
+		return fm, content, nil
+	}
+
+	lastKey := ""
+	lineIdx := 1
+
+	for len(rest) > 0 {
+		lineIdx += 1
+
+		var line []byte
+		line, rest, _ = bytes.Cut(rest, []byte("\n"))
+		l := strings.TrimRight(string(line), "\r")
+
+		if strings.TrimSpace(l) == frontMatterDelimiter {
+			return fm, rest, nil
+		}
+
+		// Ignore comments and empty lines
+		if strings.HasPrefix(strings.TrimSpace(l), "#") || strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		if item, isItem := strings.CutPrefix(strings.TrimSpace(l), "- "); isItem {
+			list, isList := fm[lastKey].([]string)
+
+			if lastKey == "" || (!isList && fm[lastKey] != "") {
+				return nil, content, fmt.Errorf("failed to parse front matter at line %v, unexpected list item", lineIdx)
+			}
+
+			fm[lastKey] = append(list, unquote(item))
+			continue
+		}
+
+		k, v, ok := strings.Cut(l, ":")
+		if !ok {
+			return nil, content, fmt.Errorf("failed to parse front matter at line %v, expected `key: value`", lineIdx)
+		}
+
+		lastKey = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+
+		if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+			list := make([]string, 0)
+
+			for _, item := range strings.Split(v[1:len(v)-1], ",") {
+				if item = unquote(item); item != "" {
+					list = append(list, item)
+				}
+			}
+
+			fm[lastKey] = list
+		} else {
+			fm[lastKey] = unquote(v)
+		}
+	}
+
+	return nil, content, fmt.Errorf("failed to parse front matter, expected closing `%v`", frontMatterDelimiter)
+}
+
+func (fm FrontMatter) String(key string) string {
+	v, _ := fm[key].(string)
+	return v
+}
+
+func (fm FrontMatter) List(key string) []string {
+	switch v := fm[key].(type) {
+	case []string:
+		return v
+	case string:
+		if v == "" {
+			return []string{}
+		}
+		return []string{v}
+	default:
+		return []string{}
+	}
+}
+
+func (fm FrontMatter) Bool(key string) bool {
+	return fm.String(key) == "true"
+}
+
+func cutLine(content []byte, line string) ([]byte, bool) {
+	first, rest, _ := bytes.Cut(content, []byte("\n"))
+
+	if strings.TrimRight(string(first), "\r ") != line {
+		return content, false
+	}
+
+	return rest, true
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		input        string
+		expected     FrontMatter
+		expectedBody string
+	}{
+		{"# Title\n\nText", FrontMatter{}, "# Title\n\nText"},
+		{"---\ntags: [go, \"web\"]\n---\n# Title", FrontMatter{"tags": []string{"go", "web"}}, "# Title"},
+		{"---\r\nauthor: misha\r\n---\r\n# Title", FrontMatter{"author": "misha"}, "# Title"},
+		{"---\n# comment\ntags:\n  - go\n  - 'web'\ndraft: true\n---\n", FrontMatter{"tags": []string{"go", "web"}, "draft": "true"}, ""},
+		{"---\ntitle: a: b\n---\ntext", FrontMatter{"title": "a: b"}, "text"},
+	}
+
+	for idx, test := range tests {
+		fm, body, err := ParseFrontMatter([]byte(test.input))
+		if err != nil {
+			t.Errorf("%v) ParseFrontMatter('%v'): unexpected error: %v", idx, test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(fm, test.expected) {
+			t.Errorf("%v) ParseFrontMatter('%v'): expected '%v' but got '%v'", idx, test.input, test.expected, fm)
+		}
+		if string(body) != test.expectedBody {
+			t.Errorf("%v) ParseFrontMatter('%v'): expected body '%v' but got '%v'", idx, test.input, test.expectedBody, string(body))
+		}
+	}
+
+	for idx, input := range []string{"---\ntags: [go]\n", "---\nno value\n---\n", "---\n- item\n---\n"} {
+		if _, _, err := ParseFrontMatter([]byte(input)); err == nil {
+			t.Errorf("%v) ParseFrontMatter('%v'): expected error", idx, input)
+		}
+	}
+}
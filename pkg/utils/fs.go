@@ -1,18 +1,136 @@
 package utils
 
 import (
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// Fs reads blog sources by their os paths, either from the working tree
+// or from a snapshot of it, e.g. a git commit
+type Fs interface {
+	ReadFile(path string) ([]byte, error)
+	Stat(path string) (fs.FileInfo, error)
+	Glob(pattern string) ([]string, error)
+	// Sub returns file system rooted at `dir`
+	Sub(dir string) (fs.FS, error)
+}
+
+// OsFs reads sources from the working tree
+type OsFs struct{}
+
+func (OsFs) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (OsFs) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (OsFs) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (OsFs) Sub(dir string) (fs.FS, error) {
+	return os.DirFS(dir), nil
+}
+
+// MountedFs reads sources from `fsys` as if it was mounted at `dir`
+type MountedFs struct {
+	dir  string
+	fsys fs.FS
+}
+
+func NewMountedFs(dir string, fsys fs.FS) (MountedFs, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return MountedFs{}, err
+	}
+
+	return MountedFs{abs, fsys}, nil
+}
+
+func (m MountedFs) ReadFile(path string) ([]byte, error) {
+	rel, err := m.rel(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.ReadFile(m.fsys, rel)
+}
+
+func (m MountedFs) Stat(path string) (fs.FileInfo, error) {
+	rel, err := m.rel(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Stat(m.fsys, rel)
+}
+
+func (m MountedFs) Glob(pattern string) ([]string, error) {
+	rel, err := m.rel(pattern)
+	if err != nil {
+		return nil, nil
+	}
+
+	matches, err := fs.Glob(m.fsys, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, match := range matches {
+		matches[idx] = filepath.Join(m.dir, filepath.FromSlash(match))
+	}
+
+	return matches, nil
+}
+
+func (m MountedFs) Sub(dir string) (fs.FS, error) {
+	rel, err := m.rel(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Sub(m.fsys, rel)
+}
+
+// rel returns slash-separated path of the os `path` in the mounted file system
+func (m MountedFs) rel(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(m.dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: "open", Path: path, Err: fmt.Errorf("%w: path is outside of %v", fs.ErrNotExist, m.dir)}
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
 func CopyDir(src, dst string) error {
-	return fs.WalkDir(os.DirFS(src), ".", func(path string, d fs.DirEntry, err error) error {
+	return CopyFsFunc(os.DirFS(src), dst, nil)
+}
+
+// CopyFsFunc copies `src` file system to `dst` directory skipping entries for which `skip` returns true
+func CopyFsFunc(src fs.FS, dst string, skip func(path string, d fs.DirEntry) bool) error {
+	return fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
+		if skip != nil && skip(path, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
 		if d.IsDir() {
 			return os.MkdirAll(filepath.Join(dst, path), os.ModePerm)
 		}
@@ -23,7 +141,7 @@ func CopyDir(src, dst string) error {
 		}
 		defer out.Close()
 
-		in, err := os.Open(filepath.Join(src, path))
+		in, err := src.Open(path)
 		if err != nil {
 			return err
 		}
@@ -33,3 +151,16 @@ func CopyDir(src, dst string) error {
 		return err
 	})
 }
+
+// WriteFileAtomic writes file next to `path` and renames it over `path`,
+// so that readers never see partially written content
+func WriteFileAtomic(path string, data []byte) error {
+	tmp := path + ".b3-tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}